@@ -1,42 +1,83 @@
 package calc
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 )
 
 type Evaluator struct {
-	condFac  ICondHelper
-	condArgs interface{}
+	cond      *condHelper // 变量形式的条件
+	paramCond *condHelper // 带参数的条件
+	strict    bool
+	checked   bool
+	funcs     map[string]*Func
+	backend   Backend
 }
 
 func NewEvaluator() *Evaluator {
 	e := new(Evaluator)
+	e.backend = DefaultBackend
 	return e
 }
 
 /**
- * @description: 条件辅助类，负责对条件求值
- * @param {*}
+ * @description: 严格模式下布尔值不能参与算术运算，?:、&&、||和!的操作数必须是布尔值.
+ * 非严格模式下布尔值按0和1参与运算，非零数字以及非空字符串作为条件时为真
+ * @param {bool} strict
  * @return {*}
  */
-type ICondHelper interface {
-	Eval(name string, args interface{}) int
+func (e *Evaluator) SetStrict(strict bool) {
+	e.strict = strict
 }
 
-func (e *Evaluator) SetCondHelper(condFac ICondHelper, condArgs interface{}) {
-	e.condFac = condFac
-	e.condArgs = condArgs
+/**
+ * @description: 开启后两个整数的+ - * /、取负以及abs溢出时返回错误(ErrIntegerOverflow)，而不是回绕.
+ * 无论是否开启，整数除以0以及**溢出都会返回错误
+ * @param {bool} checked
+ * @return {*}
+ */
+func (e *Evaluator) SetChecked(checked bool) {
+	e.checked = checked
 }
 
 func (e Evaluator) Eval(content string, env Env) (n int, err error) {
+	v, err := e.EvalValue(content, env)
+	return v.Int(), err
+}
+
+/**
+ * @description: 与Eval相同，但是返回最后一条语句的原始值
+ * @param {string} content
+ * @param {Env} env
+ * @return {*}
+ */
+func (e Evaluator) EvalValue(content string, env Env) (Value, error) {
+	return e.EvalContext(context.Background(), content, env)
+}
+
+/**
+ * @description: 与EvalValue相同，ctx被取消或者超时后停止求值并返回ctx.Err()，
+ * ctx会被传给条件辅助类和注册的函数
+ * @param {context.Context} ctx
+ * @param {string} content
+ * @param {Env} env
+ * @return {*}
+ */
+func (e Evaluator) EvalContext(ctx context.Context, content string, env Env) (v Value, err error) {
 	scanner := new(Scanner)
 	scanner.Init(content)
-	statements := Parse(scanner)
+	statements, err := ParseE(scanner)
+	if err != nil {
+		return Value{}, err
+	}
+	if err = e.Check(statements); err != nil {
+		return Value{}, err
+	}
 	for _, s := range statements {
-		n, err = e.EvaluateStmt(s, env)
+		v, err = e.evaluateStmt(ctx, s, env)
 		if err != nil {
-			err = fmt.Errorf("evaluator failed to eval: %s", err)
+			err = fmt.Errorf("evaluator failed to eval: %w", err)
 			break
 		}
 	}
@@ -44,157 +85,426 @@ func (e Evaluator) Eval(content string, env Env) (n int, err error) {
 }
 
 func (e Evaluator) EvaluateStmt(statement Statement, env Env) (int, error) {
+	v, err := e.EvaluateStmtValue(statement, env)
+	if err != nil {
+		return 0, err
+	}
+	return v.Int(), nil
+}
+
+func (e Evaluator) EvaluateStmtValue(statement Statement, env Env) (Value, error) {
+	return e.EvaluateStmtContext(context.Background(), statement, env)
+}
+
+/**
+ * @description: 对一条语句求值，语句可以是手工构造的，不合法的语法树会返回错误(ErrInvalidNode)
+ * @param {context.Context} ctx
+ * @param {Statement} statement
+ * @param {Env} env
+ * @return {*}
+ */
+func (e Evaluator) EvaluateStmtContext(ctx context.Context, statement Statement, env Env) (Value, error) {
+	if err := validateStmt(statement); err != nil {
+		return Value{}, err
+	}
+	return e.evaluateStmt(ctx, statement, env)
+}
+
+// evaluateStmt 语句必须是合法的
+func (e Evaluator) evaluateStmt(ctx context.Context, statement Statement, vars variables) (Value, error) {
+	if e.backend == BackendVM {
+		bc, err := e.compile(statement, nil)
+		if err != nil {
+			return Value{}, err
+		}
+		return e.run(ctx, bc, vars, nil)
+	}
 	switch stmt := statement.(type) {
 	case *ExpressionStatement:
-		v, err := e.evaluateExpr(stmt.Expr, env)
+		v, err := e.evaluateExpr(ctx, stmt.Expr, vars)
 		if err != nil {
-			return 0, err
+			return Value{}, err
 		}
 		return v, nil
 	case *VarDefStatement:
-		v, err := e.evaluateExpr(stmt.Expr, env)
+		v, err := e.evaluateExpr(ctx, stmt.Expr, vars)
+		if err != nil {
+			return Value{}, err
+		}
+		vars.define(stmt.VarName, v)
+		return v, nil
+	case *slotDefStatement:
+		v, err := e.evaluateExpr(ctx, stmt.Expr, vars)
 		if err != nil {
-			return 0, err
+			return Value{}, err
 		}
-		env[stmt.VarName] = v
+		vars.(*Frame).set(stmt.slot, v)
 		return v, nil
 	default:
-		panic("Unknown Statement type")
+		return Value{}, errorAt(statement, "%w: unknown statement type %T", ErrInvalidNode, statement)
+	}
+}
+
+// 对?:、&&、||和!的操作数求真假
+func (eva Evaluator) condition(expr Expression, v Value) (bool, error) {
+	if eva.strict && v.Kind() != KindBool {
+		return false, errorOf(expr, &TypeError{Msg: fmt.Sprintf("non-boolean condition: %s", v.Kind())})
 	}
+	return v.isTrue(), nil
 }
 
-func (eva Evaluator) evalIdWithCond(id string) (ret int, ok bool) {
-	if eva.condFac == nil {
-		return 0, false
+func (eva Evaluator) evaluateCall(ctx context.Context, e *CallExpression, vars variables) (Value, error) {
+	fn := eva.lookupFunc(e.Name)
+	if fn == nil && eva.paramCond == nil {
+		return Value{}, errorAt(e, "undefined function: %s", e.Name)
 	}
+	args := make([]Value, len(e.Args))
+	for i, arg := range e.Args {
+		v, err := eva.evaluateExpr(ctx, arg, vars)
+		if err != nil {
+			return Value{}, err
+		}
+		args[i] = v
+	}
+	return eva.invoke(ctx, e, fn, args)
+}
 
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("error while eval cond [%s]: %s\n", id, r)
+// invoke 调用函数，fn为nil时按带参数的条件求值
+func (eva Evaluator) invoke(ctx context.Context, e *CallExpression, fn *Func, args []Value) (Value, error) {
+	if fn == nil {
+		return eva.evalParamCond(ctx, e, args)
+	}
+	if err := fn.bind(e.Name, args); err != nil {
+		return Value{}, errorOf(e, err)
+	}
+	var v Value
+	var err error
+	if eva.checked && fn.checkedCall != nil {
+		v, err = fn.checkedCall(args)
+	} else {
+		v, err = fn.call(ctx, args)
+	}
+	if err != nil {
+		// 内置函数中运算返回的类型错误同样补上节点
+		var te *TypeError
+		if errors.As(err, &te) && te.Node == nil {
+			te.Position, te.Node = e.Pos(), e
 		}
-	}()
-	ret = eva.condFac.Eval(id, eva.condArgs)
-	ok = true
-	return
+		return Value{}, errorAt(e, "%s: %w", e.Name, err)
+	}
+	return v, nil
+}
+
+// lookupVar 先查找变量，找不到时通过条件辅助类求值，条件的结果会保存到变量中
+func (eva Evaluator) lookupVar(ctx context.Context, e *IdentifierExpression, vars variables) (Value, error) {
+	if v, ok, err := vars.lookup(e.Lit); ok {
+		if err != nil {
+			return Value{}, errorAt(e, "variable %s: %s", e.Lit, err)
+		}
+		return v, nil
+	}
+	v, ok, err := eva.evalIdWithCond(ctx, e)
+	if err != nil {
+		return Value{}, err
+	}
+	if !ok {
+		return Value{}, errorOf(e, &UndefinedVariableError{Position: e.Pos(), Node: e, Name: e.Lit})
+	}
+	vars.define(e.Lit, v)
+	return v, nil
+}
+
+// lookupSlot 与lookupVar相同，但是按编译时分配的槽位读写变量
+func (eva Evaluator) lookupSlot(ctx context.Context, e *IdentifierExpression, f *Frame, slot int) (Value, error) {
+	if v, ok, err := f.get(slot); ok {
+		if err != nil {
+			return Value{}, errorAt(e, "variable %s: %s", e.Lit, err)
+		}
+		return v, nil
+	}
+	v, ok, err := eva.evalIdWithCond(ctx, e)
+	if err != nil {
+		return Value{}, err
+	}
+	if !ok {
+		return Value{}, errorOf(e, &UndefinedVariableError{Position: e.Pos(), Node: e, Name: e.Lit})
+	}
+	f.set(slot, v)
+	return v, nil
+}
+
+func (eva Evaluator) unaryMinus(e *UnaryMinusExpression, v Value) (Value, error) {
+	if !eva.strict {
+		v = v.promoteBool()
+	}
+	if eva.checked && v.kind == KindInt && v.i == minInt {
+		return Value{}, errorAt(e, "%w: -%d", ErrIntegerOverflow, v.i)
+	}
+	v, err := negate(v)
+	if err != nil {
+		return Value{}, errorOf(e, err)
+	}
+	return v, nil
+}
+
+func (eva Evaluator) bitNot(e *UnaryBitNotExpression, v Value) (Value, error) {
+	if !eva.strict {
+		v = v.promoteBool()
+	}
+	v, err := complement(v)
+	if err != nil {
+		return Value{}, errorOf(e, err)
+	}
+	return v, nil
+}
+
+func (eva Evaluator) binOp(e *BinOpExpression, lhsV, rhsV Value) (Value, error) {
+	if !eva.strict {
+		lhsV, rhsV = lhsV.promoteBool(), rhsV.promoteBool()
+	}
+	var v Value
+	var err error
+	switch e.Operator {
+	case EQ, NE, GE, GT, LE, LT:
+		v, err = compare(e.Operator, lhsV, rhsV)
+	case '+', '-', '*', '/', '%', POW:
+		if eva.checked {
+			v, err = checkedArith(e.Operator, lhsV, rhsV)
+		} else {
+			v, err = arith(e.Operator, lhsV, rhsV)
+		}
+	case '&', '|', '^', SHL, SHR:
+		v, err = bitwise(e.Operator, lhsV, rhsV)
+	default:
+		return Value{}, errorAt(e, "%w: unknown operator %s", ErrInvalidNode, operatorName(e.Operator))
+	}
+	if err != nil {
+		return Value{}, errorOf(e, err)
+	}
+	return v, nil
+}
+
+// inSet 在预先生成的哈希表中查找，手工构造的节点没有哈希表时逐个比较
+func (eva Evaluator) inSet(e *InSetExpression, lhsV Value) bool {
+	if e.set != nil {
+		return e.set.contains(lhsV, eva.strict)
+	}
+	for _, ele := range e.Arr {
+		if r, ok := ele.(*RangeExpression); ok && eva.inRange(lhsV, r) {
+			return true
+		}
+		if eleV, ok := elementValue(ele); ok && eva.inEquals(lhsV, eleV) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxArrayRange 数组字面量作为值使用时整数区间会被展开，限制展开后的元素个数
+const maxArrayRange = 1 << 20
+
+// newArray 用元素的值创建数组，整数区间展开为其中的每个整数，values中与区间对应的值会被忽略
+func (eva Evaluator) newArray(e *ArrayExpression, values []Value) (Value, error) {
+	elems := make([]Value, 0, len(values))
+	for i, ele := range e.Arr {
+		r, ok := ele.(*RangeExpression)
+		if !ok {
+			elems = append(elems, values[i])
+			continue
+		}
+		if n := r.High - r.Low; n < 0 || n >= maxArrayRange-len(elems) {
+			return Value{}, errorAt(r, "range is too large to be used as an array")
+		}
+		for x := r.Low; x <= r.High; x++ {
+			elems = append(elems, IntValue(x))
+		}
+	}
+	return ArrayValue(elems), nil
 }
 
-func (eva Evaluator) evaluateExpr(expr Expression, env Env) (int, error) {
+// inArray in后面不是数组字面量时，在表达式求值得到的数组中查找
+func (eva Evaluator) inArray(e *InExpression, lhsV, arrV Value) (bool, error) {
+	if arrV.kind != KindArray {
+		return false, errorOf(e.RHS, &TypeError{Msg: fmt.Sprintf("in expects an array, got %s", arrV.Kind())})
+	}
+	for _, eleV := range arrV.Array() {
+		if eva.inEquals(lhsV, eleV) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (eva Evaluator) inRange(lhsV Value, r *RangeExpression) bool {
+	if !eva.strict {
+		lhsV = lhsV.promoteBool()
+	}
+	return inRange(lhsV, r)
+}
+
+// inEquals in运算中判断左边的值是否等于数组中的元素
+func (eva Evaluator) inEquals(lhsV, eleV Value) bool {
+	if !eva.strict {
+		lhsV, eleV = lhsV.promoteBool(), eleV.promoteBool()
+	}
+	return equals(lhsV, eleV)
+}
+
+func (eva Evaluator) evaluateExpr(ctx context.Context, expr Expression, vars variables) (Value, error) {
+	if err := ctx.Err(); err != nil {
+		return Value{}, err
+	}
 	switch e := expr.(type) {
 	case *NumberExpression:
-		return e.Val, nil
+		return IntValue(e.Val), nil
+	case *FloatExpression:
+		return FloatValue(e.Val), nil
+	case *StringExpression:
+		return StringValue(e.Val), nil
+	case *BoolExpression:
+		return BoolValue(e.Val), nil
 	case *IdentifierExpression:
-		if v, ok := env[e.Lit]; ok {
-			return v, nil
-		}
-		if v, ok := eva.evalIdWithCond(e.Lit); ok {
-			env[e.Lit] = v
-			return v, nil
-		} else {
-			return 0, fmt.Errorf("undefined variable: %s", e.Lit)
+		return eva.lookupVar(ctx, e, vars)
+	case *slotExpression:
+		return eva.lookupSlot(ctx, e.IdentifierExpression, vars.(*Frame), e.slot)
+	case *CallExpression:
+		return eva.evaluateCall(ctx, e, vars)
+	case *ArrayExpression:
+		values := make([]Value, len(e.Arr))
+		for i, ele := range e.Arr {
+			if _, ok := ele.(*RangeExpression); ok {
+				continue
+			}
+			v, err := eva.evaluateExpr(ctx, ele, vars)
+			if err != nil {
+				return Value{}, err
+			}
+			values[i] = v
 		}
+		return eva.newArray(e, values)
 	case *UnaryMinusExpression:
-		v, err := eva.evaluateExpr(e.SubExpr, env)
+		v, err := eva.evaluateExpr(ctx, e.SubExpr, vars)
 		if err != nil {
-			return 0, err
+			return Value{}, err
 		}
-		return -v, nil
+		return eva.unaryMinus(e, v)
+	case *UnaryBitNotExpression:
+		v, err := eva.evaluateExpr(ctx, e.SubExpr, vars)
+		if err != nil {
+			return Value{}, err
+		}
+		return eva.bitNot(e, v)
 	case *UnaryNotExpression:
-		v, err := eva.evaluateExpr(e.SubExpr, env)
+		v, err := eva.evaluateExpr(ctx, e.SubExpr, vars)
 		if err != nil {
-			return 0, err
+			return Value{}, err
 		}
-		if v == 0 {
-			v = 1
-		} else {
-			v = 0
+		b, err := eva.condition(e.SubExpr, v)
+		if err != nil {
+			return Value{}, err
 		}
-		return v, nil
+		return BoolValue(!b), nil
 	case *ParenExpression:
-		v, err := eva.evaluateExpr(e.SubExpr, env)
+		v, err := eva.evaluateExpr(ctx, e.SubExpr, vars)
 		if err != nil {
-			return 0, err
+			return Value{}, err
 		}
 		return v, nil
 	case *BinOpExpression:
-		lhsV, err := eva.evaluateExpr(e.LHS, env)
-		if err != nil {
-			return 0, err
-		}
-		rhsV, err := eva.evaluateExpr(e.RHS, env)
-		if err != nil {
-			return 0, err
-		}
-		switch e.Operator {
-		case EQ:
-			return boolToInt(lhsV == rhsV), nil
-		case NE:
-			return boolToInt(lhsV != rhsV), nil
-		case GE:
-			return boolToInt(lhsV >= rhsV), nil
-		case GT:
-			return boolToInt(lhsV > rhsV), nil
-		case LE:
-			return boolToInt(lhsV <= rhsV), nil
-		case LT:
-			return boolToInt(lhsV < rhsV), nil
-		case '+':
-			return lhsV + rhsV, nil
-		case '-':
-			return lhsV - rhsV, nil
-		case '*':
-			return lhsV * rhsV, nil
-		case '/':
-			return lhsV / rhsV, nil
-		case '%':
-			return lhsV % rhsV, nil
-		default:
-			panic("Unknown operator")
+		lhsV, err := eva.evaluateExpr(ctx, e.LHS, vars)
+		if err != nil {
+			return Value{}, err
+		}
+		rhsV, err := eva.evaluateExpr(ctx, e.RHS, vars)
+		if err != nil {
+			return Value{}, err
 		}
+		return eva.binOp(e, lhsV, rhsV)
 	case *BinOpLogicExpression:
-		lhsV, err := eva.evaluateExpr(e.LHS, env)
+		lhsV, err := eva.evaluateExpr(ctx, e.LHS, vars)
+		if err != nil {
+			return Value{}, err
+		}
+		lhsB, err := eva.condition(e.LHS, lhsV)
 		if err != nil {
-			return 0, err
+			return Value{}, err
 		}
 		if e.Operator == LAND {
-			if lhsV == 0 {
-				return 0, nil
+			if !lhsB {
+				return BoolValue(false), nil
 			}
 		} else {
-			if lhsV != 0 {
-				return 1, nil
+			if lhsB {
+				return BoolValue(true), nil
 			}
 		}
 
-		rhsV, err := eva.evaluateExpr(e.RHS, env)
+		rhsV, err := eva.evaluateExpr(ctx, e.RHS, vars)
+		if err != nil {
+			return Value{}, err
+		}
+		rhsB, err := eva.condition(e.RHS, rhsV)
 		if err != nil {
-			return 0, err
+			return Value{}, err
 		}
-		return boolToInt(rhsV != 0), nil
+		return BoolValue(rhsB), nil
 	case *InExpression:
-		lhsV, err := eva.evaluateExpr(e.LHS, env)
+		lhsV, err := eva.evaluateExpr(ctx, e.LHS, vars)
 		if err != nil {
-			return 0, err
+			return Value{}, err
+		}
+		if e.RHS != nil {
+			arrV, err := eva.evaluateExpr(ctx, e.RHS, vars)
+			if err != nil {
+				return Value{}, err
+			}
+			found, err := eva.inArray(e, lhsV, arrV)
+			if err != nil {
+				return Value{}, err
+			}
+			return BoolValue(found != e.Not), nil
 		}
-		var v int = 0
+		var found bool = false
 		for _, ele := range e.Arr {
-			if lhsV == ele.Val {
-				v = 1
+			if r, ok := ele.(*RangeExpression); ok {
+				if eva.inRange(lhsV, r) {
+					found = true
+					break
+				}
+				continue
+			}
+			eleV, err := eva.evaluateExpr(ctx, ele, vars)
+			if err != nil {
+				return Value{}, err
+			}
+			if eva.inEquals(lhsV, eleV) {
+				found = true
 				break
 			}
 		}
-		return v, nil
+		return BoolValue(found != e.Not), nil
+	case *InSetExpression:
+		lhsV, err := eva.evaluateExpr(ctx, e.LHS, vars)
+		if err != nil {
+			return Value{}, err
+		}
+		return BoolValue(eva.inSet(e, lhsV) != e.Not), nil
 	case *TernaryExpression:
-		condV, err := eva.evaluateExpr(e.Cond, env)
+		condV, err := eva.evaluateExpr(ctx, e.Cond, vars)
+		if err != nil {
+			return Value{}, err
+		}
+		condB, err := eva.condition(e.Cond, condV)
 		if err != nil {
-			return 0, err
+			return Value{}, err
 		}
-		if condV != 0 {
-			return eva.evaluateExpr(e.TrueExpr, env)
+		if condB {
+			return eva.evaluateExpr(ctx, e.TrueExpr, vars)
 		}
-		return eva.evaluateExpr(e.FalseExpr, env)
+		return eva.evaluateExpr(ctx, e.FalseExpr, vars)
 
 	default:
-		panic("Unknown Expression type")
+		return Value{}, errorAt(expr, "%w: unknown expression type %T", ErrInvalidNode, expr)
 	}
 }
 
@@ -211,3 +521,15 @@ func (p *Parser) Parse(content string) (stmts []Statement) {
 	scanner.Init(content)
 	return Parse(scanner)
 }
+
+func (p *Parser) ParseE(content string) ([]Statement, error) {
+	scanner := new(Scanner)
+	scanner.Init(content)
+	return ParseE(scanner)
+}
+
+func (p *Parser) ParseAll(content string) ([]Statement, ParseErrorList) {
+	scanner := new(Scanner)
+	scanner.Init(content)
+	return ParseAll(scanner)
+}
@@ -1,21 +1,42 @@
 package calc
 
 type (
+	// Node 所有语法树节点都记录了自己在源码中的位置
+	Node interface {
+		Pos() Position
+		End() Position
+	}
+
 	Statement interface {
+		Node
 		statement()
 	}
 
 	Expression interface {
+		Node
 		expression()
 	}
 )
 
+/**
+ * @description: 节点在源码中的起止位置，EndPos为节点最后一个字符之后的位置
+ */
+type Span struct {
+	StartPos Position
+	EndPos   Position
+}
+
+func (s Span) Pos() Position { return s.StartPos }
+func (s Span) End() Position { return s.EndPos }
+
 type (
 	ExpressionStatement struct {
+		Span
 		Expr Expression
 	}
 
 	VarDefStatement struct {
+		Span
 		VarName string
 		Expr    Expression
 	}
@@ -26,60 +47,127 @@ func (x *VarDefStatement) statement()     {}
 
 type (
 	NumberExpression struct {
+		Span
 		Val int
 	}
 
+	FloatExpression struct {
+		Span
+		Val float64
+	}
+
+	StringExpression struct {
+		Span
+		Val string
+	}
+
+	BoolExpression struct {
+		Span
+		Val bool
+	}
+
+	// 数组字面量，元素可以是任意表达式.整数区间只能作为数组的元素：in后面的数组中的区间不展开，
+	// 求值时逐个判断；数组作为值使用时区间会被展开为其中的每个整数
 	ArrayExpression struct {
-		Arr []NumberExpression
+		Span
+		Arr []Expression
 	}
 
+	// Not为true时表示not in.in后面是数组字面量时元素保存在Arr中，逐个求值并比较，
+	// 否则RHS为结果是数组的表达式，例如变量或者条件
 	InExpression struct {
+		Span
 		LHS Expression
-		Arr []NumberExpression
+		Arr []Expression
+		Not bool
+		RHS Expression
+	}
+
+	// RangeExpression 数组中的整数区间，例如[10..20]、[-5..-1]，包含两端
+	RangeExpression struct {
+		Span
+		Low  int
+		High int
+	}
+
+	// InSetExpression 数组中的元素都是字面量并且数量较多时，解析器和优化器会预先把数组放入哈希表
+	InSetExpression struct {
+		Span
+		LHS Expression
+		Arr []Expression
+		Not bool
+		set *valueSet
 	}
 
 	TernaryExpression struct {
+		Span
 		Cond      Expression
 		TrueExpr  Expression
 		FalseExpr Expression
 	}
 
 	IdentifierExpression struct {
+		Span
 		Lit string
 	}
 
+	// 函数调用，例如max(a, b)
+	CallExpression struct {
+		Span
+		Name string
+		Args []Expression
+	}
+
 	UnaryMinusExpression struct {
+		Span
 		SubExpr Expression
 	}
 
 	UnaryNotExpression struct {
+		Span
+		SubExpr Expression
+	}
+
+	// 按位取反~x
+	UnaryBitNotExpression struct {
+		Span
 		SubExpr Expression
 	}
 
 	ParenExpression struct {
+		Span
 		SubExpr Expression
 	}
 
 	BinOpExpression struct {
+		Span
 		LHS      Expression
 		Operator int
 		RHS      Expression
 	}
 
 	BinOpLogicExpression struct {
+		Span
 		LHS      Expression
 		Operator int
 		RHS      Expression
 	}
 )
 
-func (x *NumberExpression) expression()     {}
-func (x *ArrayExpression) expression()      {}
-func (x *IdentifierExpression) expression() {}
-func (x *UnaryMinusExpression) expression() {}
-func (x *UnaryNotExpression) expression()   {}
-func (x *ParenExpression) expression()      {}
-func (x *BinOpExpression) expression()      {}
-func (x *BinOpLogicExpression) expression() {}
-func (x *InExpression) expression()         {}
-func (x *TernaryExpression) expression()    {}
+func (x *NumberExpression) expression()      {}
+func (x *FloatExpression) expression()       {}
+func (x *StringExpression) expression()      {}
+func (x *BoolExpression) expression()        {}
+func (x *ArrayExpression) expression()       {}
+func (x *IdentifierExpression) expression()  {}
+func (x *CallExpression) expression()        {}
+func (x *UnaryMinusExpression) expression()  {}
+func (x *UnaryBitNotExpression) expression() {}
+func (x *UnaryNotExpression) expression()    {}
+func (x *ParenExpression) expression()       {}
+func (x *BinOpExpression) expression()       {}
+func (x *BinOpLogicExpression) expression()  {}
+func (x *InExpression) expression()          {}
+func (x *InSetExpression) expression()       {}
+func (x *RangeExpression) expression()       {}
+func (x *TernaryExpression) expression()     {}
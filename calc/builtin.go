@@ -0,0 +1,186 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"unicode/utf8"
+)
+
+var builtins map[string]*Func
+
+func init() {
+	builtins = map[string]*Func{
+		"min":   {Params: []Kind{KindAny, KindAny}, Variadic: true, Call: builtinMin},
+		"max":   {Params: []Kind{KindAny, KindAny}, Variadic: true, Call: builtinMax},
+		"abs":   {Params: []Kind{KindAny}, Call: builtinAbs, checkedCall: checkedAbs},
+		"clamp": {Params: []Kind{KindAny, KindAny, KindAny}, Call: builtinClamp},
+		"len":   {Params: []Kind{KindAny}, Call: builtinLen},
+		"floor": {Params: []Kind{KindAny}, Call: builtinFloor},
+		"ceil":  {Params: []Kind{KindAny}, Call: builtinCeil},
+		"round": {Params: []Kind{KindAny}, Call: builtinRound},
+		"pow":   {Params: []Kind{KindAny, KindAny}, Call: builtinPow},
+		"sqrt":  {Params: []Kind{KindAny}, Call: builtinSqrt},
+		"log2":  {Params: []Kind{KindAny}, Call: builtinLog2},
+	}
+}
+
+// ========================================
+
+func builtinMin(args []Value) (Value, error) {
+	return pick(LT, args)
+}
+
+func builtinMax(args []Value) (Value, error) {
+	return pick(GT, args)
+}
+
+/**
+ * @description: 从参数中挑出最小或最大的值，参数中有浮点数时结果为浮点数
+ * @param {int} op LT挑最小值，GT挑最大值
+ * @param {[]Value} args
+ * @return {*}
+ */
+func pick(op int, args []Value) (Value, error) {
+	ret := args[0]
+	hasFloat := ret.Kind() == KindFloat
+	for _, v := range args[1:] {
+		better, err := compare(op, v, ret)
+		if err != nil {
+			return Value{}, err
+		}
+		if better.isTrue() {
+			ret = v
+		}
+		hasFloat = hasFloat || v.Kind() == KindFloat
+	}
+	if hasFloat {
+		return FloatValue(ret.Float()), nil
+	}
+	return ret, nil
+}
+
+// builtinAbs 整数的绝对值与Go语言一样会回绕，最小的整数取绝对值仍然是它自己
+func builtinAbs(args []Value) (Value, error) {
+	switch v := args[0]; v.Kind() {
+	case KindInt:
+		if v.Int() < 0 {
+			return IntValue(-v.Int()), nil
+		}
+		return v, nil
+	case KindFloat:
+		return FloatValue(math.Abs(v.Float())), nil
+	default:
+		return Value{}, fmt.Errorf("expects a number, got %s", v.Kind())
+	}
+}
+
+// checkedAbs 开启SetChecked时使用，最小的整数取绝对值返回ErrIntegerOverflow
+func checkedAbs(args []Value) (Value, error) {
+	if v := args[0]; v.kind == KindInt && v.i == minInt {
+		return Value{}, fmt.Errorf("%w: abs(%d)", ErrIntegerOverflow, v.i)
+	}
+	return builtinAbs(args)
+}
+
+func builtinClamp(args []Value) (Value, error) {
+	v, err := pick(LT, []Value{args[0], args[2]})
+	if err != nil {
+		return Value{}, err
+	}
+	return pick(GT, []Value{v, args[1]})
+}
+
+func builtinLen(args []Value) (Value, error) {
+	switch v := args[0]; v.Kind() {
+	case KindString:
+		return IntValue(utf8.RuneCountInString(v.Str())), nil
+	case KindArray:
+		return IntValue(len(v.Array())), nil
+	default:
+		return Value{}, fmt.Errorf("expects a string or an array, got %s", v.Kind())
+	}
+}
+
+func builtinFloor(args []Value) (Value, error) {
+	return toIntWith(args[0], math.Floor)
+}
+
+func builtinCeil(args []Value) (Value, error) {
+	return toIntWith(args[0], math.Ceil)
+}
+
+func builtinRound(args []Value) (Value, error) {
+	return toIntWith(args[0], math.Round)
+}
+
+// pow(x, y)与x ** y相同
+func builtinPow(args []Value) (Value, error) {
+	return arith(POW, args[0], args[1])
+}
+
+// sqrt 整数的平方根向下取整，结果仍然是整数
+func builtinSqrt(args []Value) (Value, error) {
+	switch v := args[0]; v.Kind() {
+	case KindInt:
+		n := v.Int()
+		if n < 0 {
+			return Value{}, fmt.Errorf("expects a non-negative number, got %d", n)
+		}
+		// 浮点数的平方根可能有误差，用除法修正以免溢出
+		r := int(math.Sqrt(float64(n)))
+		for r > 0 && r > n/r {
+			r--
+		}
+		for r+1 <= n/(r+1) {
+			r++
+		}
+		return IntValue(r), nil
+	case KindFloat:
+		if v.Float() < 0 {
+			return Value{}, fmt.Errorf("expects a non-negative number, got %v", v.Float())
+		}
+		return FloatValue(math.Sqrt(v.Float())), nil
+	default:
+		return Value{}, fmt.Errorf("expects a number, got %s", v.Kind())
+	}
+}
+
+// log2 整数的结果向下取整，结果仍然是整数
+func builtinLog2(args []Value) (Value, error) {
+	switch v := args[0]; v.Kind() {
+	case KindInt:
+		if v.Int() <= 0 {
+			return Value{}, fmt.Errorf("expects a positive number, got %d", v.Int())
+		}
+		return IntValue(bits.Len(uint(v.Int())) - 1), nil
+	case KindFloat:
+		if v.Float() <= 0 {
+			return Value{}, fmt.Errorf("expects a positive number, got %v", v.Float())
+		}
+		return FloatValue(math.Log2(v.Float())), nil
+	default:
+		return Value{}, fmt.Errorf("expects a number, got %s", v.Kind())
+	}
+}
+
+/**
+ * @description: 对浮点数取整后转换为整数，整数原样返回
+ * @param {Value} v
+ * @param {func(float64) float64} fn 取整方式
+ * @return {*}
+ */
+func toIntWith(v Value, fn func(float64) float64) (Value, error) {
+	switch v.Kind() {
+	case KindInt:
+		return v, nil
+	case KindFloat:
+		f := fn(v.Float())
+		if f != f || f < math.MinInt64 || f >= math.MaxInt64 {
+			return Value{}, fmt.Errorf("%v overflows int", v)
+		}
+		return IntValue(int(f)), nil
+	default:
+		return Value{}, fmt.Errorf("expects a number, got %s", v.Kind())
+	}
+}
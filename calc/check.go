@@ -0,0 +1,79 @@
+package calc
+
+import "fmt"
+
+/**
+ * @description: 在求值之前检查语句中的函数调用，函数必须存在(设置了带参数的条件时不检查)，
+ * 参数个数必须正确，字面量参数的类型必须与函数声明的参数类型一致.也会先检查语法树是否合法(Validate)
+ * @param {[]Statement} statements
+ * @return {*}
+ */
+func (e Evaluator) Check(statements []Statement) error {
+	if err := Validate(statements); err != nil {
+		return err
+	}
+	for _, stmt := range statements {
+		var err error
+		switch s := stmt.(type) {
+		case *ExpressionStatement:
+			err = e.checkExpr(s.Expr)
+		case *VarDefStatement:
+			err = e.checkExpr(s.Expr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e Evaluator) checkExpr(expr Expression) (err error) {
+	Inspect(expr, func(node Node) bool {
+		if call, ok := node.(*CallExpression); ok && err == nil {
+			err = e.checkCall(call)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func (e Evaluator) checkCall(call *CallExpression) error {
+	fn := e.lookupFunc(call.Name)
+	if fn == nil {
+		if e.paramCond != nil {
+			// 带参数的条件只有求值时才能知道是否存在
+			return nil
+		}
+		return errorAt(call, "undefined function: %s", call.Name)
+	}
+	if err := fn.checkArity(call.Name, len(call.Args)); err != nil {
+		return errorAt(call, "%s", err)
+	}
+	for i, arg := range call.Args {
+		kind := literalKind(arg)
+		if kind == KindInvalid {
+			continue
+		}
+		if param := fn.paramKind(i); !acceptKind(param, kind) {
+			return errorOf(arg, &TypeError{Msg: fmt.Sprintf("%s: argument %d must be %s, got %s", call.Name, i+1, param, kind)})
+		}
+	}
+	return nil
+}
+
+// 字面量的类型，非字面量只有求值时才能知道类型
+func literalKind(expr Expression) Kind {
+	switch expr.(type) {
+	case *NumberExpression:
+		return KindInt
+	case *FloatExpression:
+		return KindFloat
+	case *StringExpression:
+		return KindString
+	case *BoolExpression:
+		return KindBool
+	case *ArrayExpression:
+		return KindArray
+	}
+	return KindInvalid
+}
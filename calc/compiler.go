@@ -0,0 +1,227 @@
+package calc
+
+type opcode uint8
+
+const (
+	opConst       opcode = iota // 压入常量consts[arg]
+	opLoad                      // 压入变量的值，变量不存在时通过条件辅助类求值.arg为槽位，-1表示按变量名查找
+	opUndefined                 // 调用了不存在的函数，执行到这里时报错
+	opCall                      // 调用funcs[arg]，arg为-1时按带参数的条件求值，参数在栈顶
+	opNeg                       // 取负
+	opBitNot                    // 按位取反
+	opNot                       // 逻辑非
+	opBinOp                     // 算术运算和比较运算
+	opBool                      // 将栈顶转换为布尔值
+	opAnd                       // 栈顶为假时替换为false并跳转到arg，否则出栈
+	opOr                        // 栈顶为真时替换为true并跳转到arg，否则出栈
+	opJumpIfFalse               // 栈顶出栈，为假时跳转到arg
+	opJump                      // 跳转到arg
+	opInTest                    // 栈顶元素出栈，与in左边的值相等时将其替换为true并跳转到arg
+	opInFail                    // 所有元素都不相等，将in左边的值替换为false
+	opInRange                   // in左边的值在整数区间中时将其替换为true并跳转到arg
+	opInSet                     // 在InSetExpression的哈希表中查找栈顶的值
+	opInArray                   // 在栈顶的数组中查找in左边的值，数组出栈
+	opArray                     // 用栈顶的元素创建数组，整数区间对应的元素为占位的常量
+	opDefine                    // 将栈顶的值保存到var定义的变量中，arg与opLoad相同
+)
+
+type instr struct {
+	op  opcode
+	arg int
+}
+
+/**
+ * @description: 一条语句编译后的字节码，由vm执行
+ */
+type bytecode struct {
+	code     []instr
+	nodes    []Node // 与code一一对应，出错时用来报告位置
+	consts   []Value
+	funcs    []*Func
+	maxStack int
+}
+
+type compiler struct {
+	eva   Evaluator
+	slots *slotTable
+	bc    *bytecode
+	depth int
+	err   error // 遇到不认识的节点时记录错误，不再继续编译
+}
+
+/**
+ * @description: 将语句编译为字节码，函数在编译时查找
+ * @param {Statement} statement
+ * @param {*slotTable} slots 不为nil时变量按槽位读写，执行时的变量必须是*Frame
+ * @return {*}
+ */
+func (eva Evaluator) compile(statement Statement, slots *slotTable) (*bytecode, error) {
+	c := &compiler{eva: eva, slots: slots, bc: new(bytecode)}
+	switch stmt := statement.(type) {
+	case *ExpressionStatement:
+		c.expr(stmt.Expr)
+	case *VarDefStatement:
+		c.expr(stmt.Expr)
+		c.emit(opDefine, c.slot(stmt.VarName), stmt)
+	default:
+		return nil, errorAt(statement, "%w: unknown statement type %T", ErrInvalidNode, statement)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.bc, nil
+}
+
+func (c *compiler) emit(op opcode, arg int, node Node) int {
+	c.bc.code = append(c.bc.code, instr{op: op, arg: arg})
+	c.bc.nodes = append(c.bc.nodes, node)
+	return len(c.bc.code) - 1
+}
+
+// 调整栈的深度，记录最大深度用于预先分配栈
+func (c *compiler) grow(n int) {
+	c.depth += n
+	if c.depth > c.bc.maxStack {
+		c.bc.maxStack = c.depth
+	}
+}
+
+func (c *compiler) slot(name string) int {
+	if c.slots == nil {
+		return -1
+	}
+	return c.slots.index[name]
+}
+
+// 将跳转指令的目标设为下一条指令
+func (c *compiler) patch(at int) {
+	c.bc.code[at].arg = len(c.bc.code)
+}
+
+func (c *compiler) constant(v Value, node Node) {
+	c.bc.consts = append(c.bc.consts, v)
+	c.emit(opConst, len(c.bc.consts)-1, node)
+	c.grow(1)
+}
+
+func (c *compiler) expr(expr Expression) {
+	switch e := expr.(type) {
+	case *NumberExpression:
+		c.constant(IntValue(e.Val), e)
+	case *FloatExpression:
+		c.constant(FloatValue(e.Val), e)
+	case *StringExpression:
+		c.constant(StringValue(e.Val), e)
+	case *BoolExpression:
+		c.constant(BoolValue(e.Val), e)
+	case *IdentifierExpression:
+		c.emit(opLoad, c.slot(e.Lit), e)
+		c.grow(1)
+	case *CallExpression:
+		c.call(e)
+	case *ArrayExpression:
+		for _, ele := range e.Arr {
+			if _, ok := ele.(*RangeExpression); ok {
+				c.constant(Value{}, ele)
+				continue
+			}
+			c.expr(ele)
+		}
+		c.emit(opArray, 0, e)
+		c.grow(1 - len(e.Arr))
+	case *UnaryMinusExpression:
+		c.expr(e.SubExpr)
+		c.emit(opNeg, 0, e)
+	case *UnaryBitNotExpression:
+		c.expr(e.SubExpr)
+		c.emit(opBitNot, 0, e)
+	case *UnaryNotExpression:
+		c.expr(e.SubExpr)
+		c.emit(opNot, 0, e.SubExpr)
+	case *ParenExpression:
+		c.expr(e.SubExpr)
+	case *BinOpExpression:
+		c.expr(e.LHS)
+		c.expr(e.RHS)
+		c.emit(opBinOp, 0, e)
+		c.grow(-1)
+	case *BinOpLogicExpression:
+		c.expr(e.LHS)
+		op := opOr
+		if e.Operator == LAND {
+			op = opAnd
+		}
+		jump := c.emit(op, 0, e.LHS)
+		c.grow(-1)
+		c.expr(e.RHS)
+		c.emit(opBool, 0, e.RHS)
+		c.patch(jump)
+	case *InExpression:
+		c.expr(e.LHS)
+		if e.RHS != nil {
+			c.expr(e.RHS)
+			c.emit(opInArray, 0, e)
+			c.grow(-1)
+			if e.Not {
+				c.emit(opNot, 0, e)
+			}
+			return
+		}
+		var jumps []int
+		for _, ele := range e.Arr {
+			if r, ok := ele.(*RangeExpression); ok {
+				jumps = append(jumps, c.emit(opInRange, 0, r))
+				continue
+			}
+			c.expr(ele)
+			jumps = append(jumps, c.emit(opInTest, 0, ele))
+			c.grow(-1)
+		}
+		c.emit(opInFail, 0, e)
+		for _, jump := range jumps {
+			c.patch(jump)
+		}
+		if e.Not {
+			c.emit(opNot, 0, e)
+		}
+	case *InSetExpression:
+		c.expr(e.LHS)
+		c.emit(opInSet, 0, e)
+		if e.Not {
+			c.emit(opNot, 0, e)
+		}
+	case *TernaryExpression:
+		c.expr(e.Cond)
+		jumpFalse := c.emit(opJumpIfFalse, 0, e.Cond)
+		c.grow(-1)
+		c.expr(e.TrueExpr)
+		jumpEnd := c.emit(opJump, 0, e)
+		c.patch(jumpFalse)
+		c.grow(-1)
+		c.expr(e.FalseExpr)
+		c.patch(jumpEnd)
+	default:
+		if c.err == nil {
+			c.err = errorAt(expr, "%w: unknown expression type %T", ErrInvalidNode, expr)
+		}
+	}
+}
+
+func (c *compiler) call(e *CallExpression) {
+	fn := c.eva.lookupFunc(e.Name)
+	if fn == nil && c.eva.paramCond == nil {
+		c.emit(opUndefined, 0, e)
+		c.grow(1)
+		return
+	}
+	for _, arg := range e.Args {
+		c.expr(arg)
+	}
+	index := -1
+	if fn != nil {
+		c.bc.funcs = append(c.bc.funcs, fn)
+		index = len(c.bc.funcs) - 1
+	}
+	c.emit(opCall, index, e)
+	c.grow(1 - len(e.Args))
+}
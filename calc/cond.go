@@ -0,0 +1,265 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+/**
+ * @description: 条件辅助类，负责对条件求值
+ * @param {*}
+ * @return {*}
+ */
+type ICondHelper interface {
+	Eval(name string, args interface{}) int
+}
+
+/**
+ * @description: 可以返回错误的条件辅助类，条件不存在时应该返回ErrUndefinedCond
+ * @param {*}
+ * @return {*}
+ */
+type ICondHelperE interface {
+	Eval(name string, args interface{}) (int, error)
+}
+
+/**
+ * @description: 需要context的条件辅助类，ctx为EvalContext传入的context，
+ * 条件不存在时应该返回ErrUndefinedCond
+ * @param {*}
+ * @return {*}
+ */
+type ICondHelperContext interface {
+	EvalContext(ctx context.Context, name string, args interface{}) (int, error)
+}
+
+// ErrUndefinedCond 条件辅助类不认识某个条件时返回，求值器会按未定义的变量处理
+var ErrUndefinedCond = errors.New("undefined condition")
+
+/**
+ * @description: 带参数的条件，例如itemCount(1001) >= 5.
+ * 表达式中调用的函数既不是内置函数也不是注册的函数时，交给EvalParam求值.
+ * params只在调用期间有效，需要保存时应该复制
+ * @param {*}
+ * @return {*}
+ */
+type IParamCondHelper interface {
+	EvalParam(name string, params []Value, args interface{}) (int, error)
+}
+
+/**
+ * @description: 需要context的带参数的条件
+ * @param {*}
+ * @return {*}
+ */
+type IParamCondHelperContext interface {
+	EvalParamContext(ctx context.Context, name string, params []Value, args interface{}) (int, error)
+}
+
+/**
+ * @description: 需要context并且可以返回任意类型的值的条件辅助类，例如返回数组用于in运算.
+ * 求值器内部只使用这个接口，其他条件辅助类通过AdaptCondHelper转换
+ * @param {*}
+ * @return {*}
+ */
+type ICondHelperValue interface {
+	// EvalValue 对变量形式的条件求值，条件不存在时应该返回ErrUndefinedCond
+	EvalValue(ctx context.Context, name string, args interface{}) (Value, error)
+	// EvalParamValue 对带参数的条件求值，params只在调用期间有效
+	EvalParamValue(ctx context.Context, name string, params []Value, args interface{}) (Value, error)
+}
+
+// condAdapter 把只返回整数的条件辅助类适配为ICondHelperValue，没有实现的条件按不存在处理
+type condAdapter struct {
+	helper interface{}
+}
+
+func (a condAdapter) EvalValue(ctx context.Context, name string, args interface{}) (Value, error) {
+	switch h := a.helper.(type) {
+	case ICondHelperContext:
+		ret, err := h.EvalContext(ctx, name, args)
+		return IntValue(ret), err
+	case ICondHelperE:
+		ret, err := h.Eval(name, args)
+		return IntValue(ret), err
+	case ICondHelper:
+		return IntValue(h.Eval(name, args)), nil
+	}
+	return Value{}, ErrUndefinedCond
+}
+
+func (a condAdapter) EvalParamValue(ctx context.Context, name string, params []Value, args interface{}) (Value, error) {
+	switch h := a.helper.(type) {
+	case IParamCondHelperContext:
+		ret, err := h.EvalParamContext(ctx, name, params, args)
+		return IntValue(ret), err
+	case IParamCondHelper:
+		ret, err := h.EvalParam(name, params, args)
+		return IntValue(ret), err
+	}
+	return Value{}, ErrUndefinedCond
+}
+
+/**
+ * @description: 把ICondHelper、ICondHelperE、ICondHelperContext、IParamCondHelper以及IParamCondHelperContext
+ * 转换为ICondHelperValue，helper同时实现了多种接口时优先使用需要context的方法.
+ * 可以在转换后的条件辅助类上增加返回其他类型的条件，再通过SetCondHelperValue设置
+ * @param {interface{}} helper 已经实现了ICondHelperValue时直接返回
+ * @return {*} helper为nil时返回nil
+ */
+func AdaptCondHelper(helper interface{}) ICondHelperValue {
+	if h, ok := helper.(ICondHelperValue); ok || helper == nil {
+		return h
+	}
+	return condAdapter{helper: helper}
+}
+
+// 是否可以对带参数的条件求值
+func isParamCondHelper(helper interface{}) bool {
+	switch helper.(type) {
+	case ICondHelperValue, IParamCondHelperContext, IParamCondHelper:
+		return true
+	}
+	return false
+}
+
+// condHelper 设置的条件辅助类以及求值时传给它的参数
+type condHelper struct {
+	helper ICondHelperValue
+	args   interface{}
+}
+
+/**
+ * @description: 设置条件辅助类，如果condFac同时实现了IParamCondHelper，也会被用于带参数的条件
+ * @param {ICondHelper} condFac
+ * @param {interface{}} condArgs 求值时传给条件辅助类的参数
+ * @return {*}
+ */
+func (e *Evaluator) SetCondHelper(condFac ICondHelper, condArgs interface{}) {
+	e.setCondHelper(condFac, condArgs)
+}
+
+/**
+ * @description: 设置可以返回错误的条件辅助类，会替换SetCondHelper设置的条件辅助类.
+ * 如果condFac同时实现了IParamCondHelper，也会被用于带参数的条件
+ * @param {ICondHelperE} condFac
+ * @param {interface{}} condArgs 求值时传给条件辅助类的参数
+ * @return {*}
+ */
+func (e *Evaluator) SetCondHelperE(condFac ICondHelperE, condArgs interface{}) {
+	e.setCondHelper(condFac, condArgs)
+}
+
+/**
+ * @description: 设置需要context的条件辅助类，会替换之前设置的条件辅助类.
+ * 如果condFac同时实现了IParamCondHelperContext或IParamCondHelper，也会被用于带参数的条件
+ * @param {ICondHelperContext} condFac
+ * @param {interface{}} condArgs 求值时传给条件辅助类的参数
+ * @return {*}
+ */
+func (e *Evaluator) SetCondHelperContext(condFac ICondHelperContext, condArgs interface{}) {
+	e.setCondHelper(condFac, condArgs)
+}
+
+/**
+ * @description: 设置返回任意类型的值的条件辅助类，同时用于变量形式的条件和带参数的条件，会替换之前设置的条件辅助类.
+ * 因为任何调用都可能是带参数的条件，Compile和Check不再报告未定义的函数，要到求值时才会由EvalParamValue返回错误
+ * @param {ICondHelperValue} condFac 旧的条件辅助类可以通过AdaptCondHelper转换
+ * @param {interface{}} condArgs 求值时传给条件辅助类的参数
+ * @return {*}
+ */
+func (e *Evaluator) SetCondHelperValue(condFac ICondHelperValue, condArgs interface{}) {
+	e.setCondHelper(condFac, condArgs)
+}
+
+func (e *Evaluator) setCondHelper(condFac interface{}, condArgs interface{}) {
+	e.cond, e.paramCond = nil, nil
+	h := AdaptCondHelper(condFac)
+	if h == nil {
+		return
+	}
+	e.cond = &condHelper{helper: h, args: condArgs}
+	if isParamCondHelper(condFac) {
+		e.paramCond = e.cond
+	}
+}
+
+/**
+ * @description: 只设置带参数的条件辅助类
+ * @param {IParamCondHelper} paramCond
+ * @param {interface{}} condArgs
+ * @return {*}
+ */
+func (e *Evaluator) SetParamCondHelper(paramCond IParamCondHelper, condArgs interface{}) {
+	e.setParamCondHelper(paramCond, condArgs)
+}
+
+/**
+ * @description: 只设置需要context的带参数的条件辅助类
+ * @param {IParamCondHelperContext} paramCond
+ * @param {interface{}} condArgs
+ * @return {*}
+ */
+func (e *Evaluator) SetParamCondHelperContext(paramCond IParamCondHelperContext, condArgs interface{}) {
+	e.setParamCondHelper(paramCond, condArgs)
+}
+
+func (e *Evaluator) setParamCondHelper(paramCond interface{}, condArgs interface{}) {
+	e.paramCond = nil
+	if h := AdaptCondHelper(paramCond); h != nil {
+		e.paramCond = &condHelper{helper: h, args: condArgs}
+	}
+}
+
+/**
+ * @description: 通过条件辅助类对变量求值，条件辅助类返回错误或者panic时返回错误
+ * @param {*IdentifierExpression} e
+ * @return {*} 没有设置条件辅助类或者条件不存在时ok为false
+ */
+func (eva Evaluator) evalIdWithCond(ctx context.Context, e *IdentifierExpression) (ret Value, ok bool, err error) {
+	if eva.cond == nil {
+		return Value{}, false, nil
+	}
+	err = callCond(func() (err error) {
+		ret, err = eva.cond.helper.EvalValue(ctx, e.Lit, eva.cond.args)
+		return checkCondValue(ret, err)
+	})
+	if errors.Is(err, ErrUndefinedCond) {
+		return Value{}, false, nil
+	}
+	if err != nil {
+		return Value{}, false, errorOf(e, &ConditionError{Position: e.Pos(), Node: e, Name: e.Lit, Err: err})
+	}
+	return ret, true, nil
+}
+
+func (eva Evaluator) evalParamCond(ctx context.Context, e *CallExpression, params []Value) (Value, error) {
+	var ret Value
+	err := callCond(func() (err error) {
+		ret, err = eva.paramCond.helper.EvalParamValue(ctx, e.Name, params, eva.paramCond.args)
+		return checkCondValue(ret, err)
+	})
+	if err != nil {
+		return Value{}, errorOf(e, &ConditionError{Position: e.Pos(), Node: e, Name: e.Name, Err: err})
+	}
+	return ret, nil
+}
+
+// 条件辅助类返回的零值Value不是合法的值
+func checkCondValue(v Value, err error) error {
+	if err == nil && v.kind == KindInvalid {
+		return errors.New("invalid value")
+	}
+	return err
+}
+
+// 条件辅助类中的panic转换为错误
+func callCond(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,177 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/**
+ * @description: 语法错误，记录出错的位置、出错处的字面量以及期望的token
+ */
+type ParseError struct {
+	Position
+	Lit      string
+	Expected []string
+	Msg      string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Line %d, Column %d: %q %s", e.Line, e.Column, e.Lit, e.Msg)
+}
+
+/**
+ * @description: 一次解析中发现的所有语法错误
+ */
+type ParseErrorList []*ParseError
+
+func (l ParseErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err 没有错误时返回nil，否则返回列表本身
+func (l ParseErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+/**
+ * @description: 根据goyacc的详细错误信息构造ParseError
+ * @param {Position} pos 出错位置
+ * @param {string} lit 出错处的字面量
+ * @param {string} msg 形如"syntax error: unexpected X, expecting A or B"
+ * @return {*}
+ */
+func newParseError(pos Position, lit string, msg string) *ParseError {
+	e := &ParseError{Position: pos, Lit: lit, Msg: msg}
+	if i := strings.Index(msg, ", expecting "); i >= 0 {
+		for _, tok := range strings.Split(msg[i+len(", expecting "):], " or ") {
+			e.Expected = append(e.Expected, tokenDisplayName(tok))
+		}
+	}
+	return e
+}
+
+// goyacc中单字符token的名字带有引号，例如'+'
+func tokenDisplayName(name string) string {
+	if len(name) >= 3 && name[0] == '\'' && name[len(name)-1] == '\'' {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+var (
+	// ErrDivisionByZero 整数除以0或者对0取模
+	ErrDivisionByZero = errors.New("division by zero")
+	// ErrIntegerOverflow 整数运算的结果溢出，+ - * /、取负和abs只有开启SetChecked后才会检查
+	ErrIntegerOverflow = errors.New("integer overflow")
+)
+
+/**
+ * @description: 求值错误，记录出错的节点以及节点在源码中的位置，手工构造的节点没有位置信息.
+ * Err为导致错误的原因，可以通过errors.As取得UndefinedVariableError等具体的错误，
+ * 或者通过errors.Is判断，例如ErrDivisionByZero
+ */
+type EvalError struct {
+	Position
+	Node Node
+	Msg  string
+	Err  error
+}
+
+func (e *EvalError) Error() string {
+	if e.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Position, e.Msg)
+	}
+	return e.Msg
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// UndefinedVariableError 变量不存在，并且没有条件可以对它求值
+type UndefinedVariableError struct {
+	Position
+	Node *IdentifierExpression
+	Name string
+}
+
+func (e *UndefinedVariableError) Error() string {
+	return "undefined variable: " + e.Name
+}
+
+// DivisionByZeroError 整数除以0或者对0取模，errors.Is(err, ErrDivisionByZero)同样成立
+type DivisionByZeroError struct {
+	Position
+	Node *BinOpExpression
+}
+
+func (e *DivisionByZeroError) Error() string {
+	return ErrDivisionByZero.Error()
+}
+
+func (e *DivisionByZeroError) Unwrap() error {
+	return ErrDivisionByZero
+}
+
+// ConditionError 条件辅助类返回错误或者panic，Err为条件辅助类返回的错误
+type ConditionError struct {
+	Position
+	Node Node // *IdentifierExpression或者带参数的条件的*CallExpression
+	Name string
+	Err  error
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf("condition %s: %v", e.Name, e.Err)
+}
+
+func (e *ConditionError) Unwrap() error {
+	return e.Err
+}
+
+// TypeError 值的类型不符合要求，例如字符串与数字相加、严格模式下非布尔值作为条件、in后面不是数组等
+type TypeError struct {
+	Position
+	Node Node
+	Msg  string
+}
+
+func (e *TypeError) Error() string {
+	return e.Msg
+}
+
+// 为运算返回的错误补上节点，具体的错误包装在EvalError中
+func errorOf(node Node, err error) error {
+	switch e := err.(type) {
+	case *TypeError:
+		e.Position, e.Node = node.Pos(), node
+	case nil:
+		return nil
+	default:
+		if err == ErrDivisionByZero {
+			if binOp, ok := node.(*BinOpExpression); ok {
+				err = &DivisionByZeroError{Position: node.Pos(), Node: binOp}
+			}
+		}
+	}
+	return errorAt(node, "%w", err)
+}
+
+// 求值错误带上出错的节点，format中可以使用%w包装原因.node可以为nil，这时错误没有位置
+func errorAt(node Node, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	if isNilNode(node) {
+		return &EvalError{Msg: err.Error(), Err: errors.Unwrap(err)}
+	}
+	return &EvalError{Position: node.Pos(), Node: node, Msg: err.Error(), Err: errors.Unwrap(err)}
+}
@@ -1,11 +1,28 @@
 package calc
 
-import (
-	"fmt"
-	"strconv"
-)
+import "fmt"
 
-type Env map[string]int
+// Env 变量环境，值可以是任意整数、浮点数类型或者字符串
+type Env map[string]interface{}
+
+// variables 求值时对变量的读写，var定义的变量以及条件的结果通过define保存
+type variables interface {
+	lookup(name string) (v Value, ok bool, err error)
+	define(name string, v Value)
+}
+
+func (env Env) lookup(name string) (Value, bool, error) {
+	x, ok := env[name]
+	if !ok {
+		return Value{}, false, nil
+	}
+	v, err := ValueOf(x)
+	return v, true, err
+}
+
+func (env Env) define(name string, v Value) {
+	env[name] = v.Interface()
+}
 
 /**
  * @description: 单句求值
@@ -15,28 +32,27 @@ type Env map[string]int
  */
 func Evaluate(statement Statement, env Env) (string, error) {
 	eva := NewEvaluator()
-	switch stmt := statement.(type) {
-	case *ExpressionStatement:
-		v, err := eva.evaluateExpr(stmt.Expr, env)
-		if err != nil {
-			return "", err
-		}
-		return strconv.Itoa(v), nil
-	case *VarDefStatement:
-		v, err := eva.evaluateExpr(stmt.Expr, env)
-		if err != nil {
-			return "", err
-		}
-		env[stmt.VarName] = v
+	v, err := eva.EvaluateStmtValue(statement, env)
+	if err != nil {
+		return "", err
+	}
+	if stmt, ok := statement.(*VarDefStatement); ok {
 		return fmt.Sprintf("Assign %v to %s", v, stmt.VarName), nil
-	default:
-		panic("Unknown Statement type")
 	}
+	return v.String(), nil
 }
 
 func EvaluateExpr(expr Expression, env Env) (int, error) {
+	v, err := EvaluateExprValue(expr, env)
+	if err != nil {
+		return 0, err
+	}
+	return v.Int(), nil
+}
+
+func EvaluateExprValue(expr Expression, env Env) (Value, error) {
 	eva := NewEvaluator()
-	return eva.evaluateExpr(expr, env)
+	return eva.EvaluateStmtValue(&ExpressionStatement{Expr: expr}, env)
 }
 
 func boolToInt(cond bool) int {
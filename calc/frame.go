@@ -0,0 +1,221 @@
+package calc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/**
+ * @description: 编译时给脚本中出现的每个变量名分配一个槽位，求值时按下标读写变量
+ */
+type slotTable struct {
+	names []string
+	index map[string]int
+}
+
+func newSlotTable(statements []Statement) *slotTable {
+	t := &slotTable{index: make(map[string]int)}
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ExpressionStatement:
+			t.addExpr(s.Expr)
+		case *VarDefStatement:
+			t.addExpr(s.Expr)
+			t.add(s.VarName)
+		}
+	}
+	return t
+}
+
+func (t *slotTable) add(name string) {
+	if _, ok := t.index[name]; !ok {
+		t.index[name] = len(t.names)
+		t.names = append(t.names, name)
+	}
+}
+
+func (t *slotTable) addExpr(expr Expression) {
+	if isNilNode(expr) {
+		return
+	}
+	Inspect(expr, func(node Node) bool {
+		if id, ok := node.(*IdentifierExpression); ok {
+			t.add(id.Lit)
+		}
+		return true
+	})
+}
+
+// slotExpression 编译时解析为槽位的变量，遍历语法树求值时按下标读写，不再查找变量名
+type slotExpression struct {
+	*IdentifierExpression
+	slot int
+}
+
+// slotDefStatement 编译时解析为槽位的var语句
+type slotDefStatement struct {
+	*VarDefStatement
+	slot int
+}
+
+/**
+ * @description: 复制语句并把其中的变量替换为槽位，供BackendTree求值，原来的语句不会被修改
+ * @param {[]Statement} statements 合法的语句
+ * @return {*}
+ */
+func (t *slotTable) resolve(statements []Statement) []Statement {
+	ret := Transform(statements, func(expr Expression) Expression {
+		if id, ok := expr.(*IdentifierExpression); ok {
+			return &slotExpression{IdentifierExpression: id, slot: t.index[id.Lit]}
+		}
+		return nil
+	})
+	for i, stmt := range ret {
+		if def, ok := stmt.(*VarDefStatement); ok {
+			ret[i] = &slotDefStatement{VarDefStatement: def, slot: t.index[def.VarName]}
+		}
+	}
+	return ret
+}
+
+/**
+ * @description: 一次求值使用的变量，按Program分配的槽位保存在切片中.
+ * 通过Program.Bind或Program.BindStruct创建，不能在多个goroutine中同时使用
+ */
+type Frame struct {
+	slots  *slotTable
+	values []Value // 没有绑定的槽位为KindInvalid
+	errs   []error // 无法转换为Value的变量，使用时才报告错误
+	stack  []Value // BackendVM执行字节码使用的栈，在所有语句以及多次求值之间复用
+}
+
+// newFrame 变量和栈使用同一块内存
+func newFrame(slots *slotTable, maxStack int) *Frame {
+	n := len(slots.names)
+	buf := make([]Value, n+maxStack)
+	return &Frame{slots: slots, values: buf[:n:n], stack: buf[n:n]}
+}
+
+// Get 读取变量的值，包括求值过程中var定义的变量以及条件的结果
+func (f *Frame) Get(name string) (Value, bool) {
+	if slot, ok := f.slots.index[name]; ok && f.values[slot].kind != KindInvalid {
+		return f.values[slot], true
+	}
+	return Value{}, false
+}
+
+func (f *Frame) bind(slot int, x interface{}) {
+	v, err := ValueOf(x)
+	if err != nil {
+		if f.errs == nil {
+			f.errs = make([]error, len(f.values))
+		}
+		f.errs[slot] = err
+		return
+	}
+	f.values[slot] = v
+}
+
+func (f *Frame) get(slot int) (Value, bool, error) {
+	if f.errs != nil && f.errs[slot] != nil {
+		return Value{}, true, f.errs[slot]
+	}
+	v := f.values[slot]
+	return v, v.kind != KindInvalid, nil
+}
+
+func (f *Frame) set(slot int, v Value) {
+	f.values[slot] = v
+	if f.errs != nil {
+		f.errs[slot] = nil
+	}
+}
+
+// 按变量名读写，供没有解析为槽位的语句使用
+func (f *Frame) lookup(name string) (Value, bool, error) {
+	if slot, ok := f.slots.index[name]; ok {
+		return f.get(slot)
+	}
+	return Value{}, false, nil
+}
+
+func (f *Frame) define(name string, v Value) {
+	if slot, ok := f.slots.index[name]; ok {
+		f.set(slot, v)
+	}
+}
+
+// ========================================
+
+// Vars 返回脚本中出现的所有变量名，下标即槽位
+func (p *Program) Vars() []string {
+	return p.slots.names
+}
+
+/**
+ * @description: 把Env中脚本用到的变量绑定到槽位，不会修改env
+ * @param {Env} env
+ * @return {*}
+ */
+func (p *Program) Bind(env Env) *Frame {
+	f := newFrame(p.slots, p.maxStack)
+	for slot, name := range p.slots.names {
+		if x, ok := env[name]; ok {
+			f.bind(slot, x)
+		}
+	}
+	return f
+}
+
+/**
+ * @description: 把结构体的字段绑定到槽位，字段名或者`calc:"name"`标签与变量名相同时绑定，
+ * `calc:"-"`表示忽略该字段.只支持导出的字段
+ * @param {interface{}} x 结构体或者结构体指针
+ * @return {*}
+ */
+func (p *Program) BindStruct(x interface{}) (*Frame, error) {
+	rv := reflect.ValueOf(x)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("BindStruct expects a struct, got %T", x)
+	}
+	fields := p.structFields(rv.Type())
+	f := newFrame(p.slots, p.maxStack)
+	for slot, field := range fields {
+		if field >= 0 {
+			f.bind(slot, rv.Field(field).Interface())
+		}
+	}
+	return f, nil
+}
+
+// 每个槽位对应的字段下标，没有对应的字段时为-1.结果按类型缓存
+func (p *Program) structFields(typ reflect.Type) []int {
+	if fields, ok := p.structs.Load(typ); ok {
+		return fields.([]int)
+	}
+	fields := make([]int, len(p.slots.names))
+	for slot := range fields {
+		fields[slot] = -1
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Name
+		if tag, ok := sf.Tag.Lookup("calc"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		if slot, ok := p.slots.index[name]; ok {
+			fields[slot] = i
+		}
+	}
+	p.structs.Store(typ, fields)
+	return fields
+}
@@ -0,0 +1,79 @@
+package calc
+
+/**
+ * @description: 脚本依赖的外部名字，按第一次出现的顺序排列，没有重复
+ */
+type Dependencies struct {
+	// Vars 没有被前面的var定义的变量，求值时先在Env中查找，找不到时通过条件辅助类求值
+	Vars []string
+	// Calls 既不是内置函数也不是注册的函数的调用，例如itemCount(1001)，只能由带参数的条件求值
+	Calls []string
+}
+
+/**
+ * @description: 按Env把变量分为两类：Env中提供的变量，以及Env中没有、求值时需要通过条件辅助类求值的变量
+ * @param {Env} env
+ * @return {*}
+ */
+func (d Dependencies) Split(env Env) (fromEnv, conds []string) {
+	for _, name := range d.Vars {
+		if _, ok := env[name]; ok {
+			fromEnv = append(fromEnv, name)
+		} else {
+			conds = append(conds, name)
+		}
+	}
+	return
+}
+
+/**
+ * @description: 使用默认的求值器找出语句中的自由变量，只有内置函数被认为是函数
+ * @param {[]Statement} statements
+ * @return {*}
+ */
+func FreeVariables(statements []Statement) Dependencies {
+	return NewEvaluator().FreeVariables(statements)
+}
+
+/**
+ * @description: 找出语句中引用的、没有被前面的var定义的变量，以及需要由带参数的条件求值的调用.
+ * 变量在定义它的var语句中(例如var a = a + 1的右边)仍然是自由变量
+ * @param {[]Statement} statements
+ * @return {*}
+ */
+func (e Evaluator) FreeVariables(statements []Statement) Dependencies {
+	var deps Dependencies
+	defined := make(map[string]bool)
+	seen := make(map[string]bool)
+	calls := make(map[string]bool)
+	visit := func(node Node) bool {
+		switch n := node.(type) {
+		case *IdentifierExpression:
+			if !defined[n.Lit] && !seen[n.Lit] {
+				seen[n.Lit] = true
+				deps.Vars = append(deps.Vars, n.Lit)
+			}
+		case *CallExpression:
+			if e.lookupFunc(n.Name) == nil && !calls[n.Name] {
+				calls[n.Name] = true
+				deps.Calls = append(deps.Calls, n.Name)
+			}
+		}
+		return true
+	}
+	for _, stmt := range statements {
+		if isNilNode(stmt) {
+			continue
+		}
+		Inspect(stmt, visit)
+		if def, ok := stmt.(*VarDefStatement); ok {
+			defined[def.VarName] = true
+		}
+	}
+	return deps
+}
+
+// FreeVariables 返回脚本依赖的外部名字，使用编译时求值器注册的函数
+func (p *Program) FreeVariables() Dependencies {
+	return p.eva.FreeVariables(p.statements)
+}
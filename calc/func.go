@@ -0,0 +1,126 @@
+package calc
+
+import (
+	"context"
+	"fmt"
+)
+
+/**
+ * @description: 可以在表达式中调用的函数
+ */
+type Func struct {
+	// Params 参数类型，KindAny表示接受任意类型，KindFloat也接受整数
+	Params []Kind
+	// Variadic 为true时最后一个参数可以出现任意次(包括0次)
+	Variadic bool
+	// Call 实现函数，args只在调用期间有效，需要保存时应该复制
+	Call func(args []Value) (Value, error)
+	// CallContext 需要context时代替Call，ctx为EvalContext传入的context
+	CallContext func(ctx context.Context, args []Value) (Value, error)
+	// checkedCall 开启SetChecked时代替Call，只有会溢出的内置函数使用
+	checkedCall func(args []Value) (Value, error)
+}
+
+func (f *Func) call(ctx context.Context, args []Value) (Value, error) {
+	if f.CallContext != nil {
+		return f.CallContext(ctx, args)
+	}
+	return f.Call(args)
+}
+
+func (f *Func) minArgs() int {
+	if f.Variadic {
+		return len(f.Params) - 1
+	}
+	return len(f.Params)
+}
+
+func (f *Func) checkArity(name string, n int) error {
+	least := f.minArgs()
+	switch {
+	case f.Variadic && n < least:
+		return fmt.Errorf("%s expects at least %d arguments, got %d", name, least, n)
+	case !f.Variadic && n != least:
+		return fmt.Errorf("%s expects %d arguments, got %d", name, least, n)
+	}
+	return nil
+}
+
+// 第i个参数的类型
+func (f *Func) paramKind(i int) Kind {
+	if i >= len(f.Params) {
+		return f.Params[len(f.Params)-1]
+	}
+	return f.Params[i]
+}
+
+func acceptKind(param, arg Kind) bool {
+	return param == KindAny || param == arg || (param == KindFloat && arg == KindInt)
+}
+
+/**
+ * @description: 检查参数的个数和类型，整数传给浮点数参数时会被转换为浮点数
+ * @param {string} name
+ * @param {[]Value} args
+ * @return {*}
+ */
+func (f *Func) bind(name string, args []Value) error {
+	if err := f.checkArity(name, len(args)); err != nil {
+		return err
+	}
+	for i, arg := range args {
+		param := f.paramKind(i)
+		if !acceptKind(param, arg.Kind()) {
+			return &TypeError{Msg: fmt.Sprintf("%s: argument %d must be %s, got %s", name, i+1, param, arg.Kind())}
+		}
+		if param == KindFloat && arg.Kind() == KindInt {
+			args[i] = FloatValue(arg.Float())
+		}
+	}
+	return nil
+}
+
+/**
+ * @description: 注册可以在表达式中调用的函数，与内置函数同名时会覆盖内置函数
+ * @param {string} name 函数名，必须是合法的标识符
+ * @param {*Func} fn
+ * @return {*}
+ */
+func (e *Evaluator) RegisterFunc(name string, fn *Func) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	if fn == nil || (fn.Call == nil && fn.CallContext == nil) {
+		return fmt.Errorf("function %s has no implementation", name)
+	}
+	if fn.Variadic && len(fn.Params) == 0 {
+		return fmt.Errorf("variadic function %s must declare at least one parameter", name)
+	}
+	if e.funcs == nil {
+		e.funcs = make(map[string]*Func)
+	}
+	e.funcs[name] = fn
+	return nil
+}
+
+func (e Evaluator) lookupFunc(name string) *Func {
+	if fn, ok := e.funcs[name]; ok {
+		return fn
+	}
+	return builtins[name]
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	if _, ok := keywords[name]; ok {
+		return false
+	}
+	for i, ch := range name {
+		if !isLetter(ch) && (i == 0 || !isDigit(ch)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package calc
+
+import "math"
+
+// InSetThreshold 数组中的字面量达到这个数量时，in运算改为在预先生成的哈希表中查找，
+// 修改后只影响之后解析的脚本.默认值来自unittest中的BenchmarkIn：只有一两个元素时逐个比较更快，
+// 达到4个元素时即使要比较所有元素，哈希表也明显更快
+var InSetThreshold = 4
+
+/**
+ * @description: 创建in表达式，数组中的元素都是字面量并且数量达到InSetThreshold时预先生成哈希表
+ * @param {Span} span
+ * @param {Expression} lhs
+ * @param {[]Expression} arr
+ * @param {bool} not 是否为not in
+ * @return {*}
+ */
+func newInExpression(span Span, lhs Expression, arr []Expression, not bool) Expression {
+	if len(arr) >= InSetThreshold {
+		if set := literalSet(arr); set != nil {
+			return &InSetExpression{Span: span, LHS: lhs, Arr: arr, Not: not, set: set}
+		}
+	}
+	return &InExpression{Span: span, LHS: lhs, Arr: arr, Not: not}
+}
+
+// 数组中有非字面量或者无法放入哈希表的元素时返回nil
+func literalSet(arr []Expression) *valueSet {
+	values := make([]Value, 0, len(arr))
+	var ranges []*RangeExpression
+	for _, ele := range arr {
+		if r, ok := ele.(*RangeExpression); ok {
+			ranges = append(ranges, r)
+			continue
+		}
+		v, ok := elementValue(ele)
+		if !ok {
+			return nil
+		}
+		values = append(values, v)
+	}
+	set := newValueSet(values)
+	if set != nil {
+		set.ranges = ranges
+	}
+	return set
+}
+
+// elementValue 负数在语法树中是对数字字面量取负，同样当作字面量
+func elementValue(ele Expression) (Value, bool) {
+	if neg, ok := ele.(*UnaryMinusExpression); ok {
+		switch e := neg.SubExpr.(type) {
+		case *NumberExpression:
+			return IntValue(-e.Val), true
+		case *FloatExpression:
+			return FloatValue(-e.Val), true
+		}
+		return Value{}, false
+	}
+	return constValue(ele)
+}
+
+/**
+ * @description: 判断值是否在整数区间中，值为整数的浮点数也在区间中
+ * @param {Value} v 非严格模式下布尔值应该已经转换为整数
+ * @param {*RangeExpression} r
+ * @return {*}
+ */
+func inRange(v Value, r *RangeExpression) bool {
+	switch v.kind {
+	case KindInt:
+		return r.Low <= v.i && v.i <= r.High
+	case KindFloat:
+		return v.f == math.Trunc(v.f) && float64(r.Low) <= v.f && v.f <= float64(r.High)
+	}
+	return false
+}
+
+// 绝对值不超过2^53的整数转换为浮点数时没有误差
+const maxExactFloat = 1 << 53
+
+/**
+ * @description: in运算使用的哈希表，与逐个调用equals的结果相同.
+ * 整数和值为整数的浮点数使用同一个key，布尔值单独保存，非严格模式下查找时再按0和1处理.
+ * 整数区间不展开，查找时逐个判断
+ */
+type valueSet struct {
+	m      map[Value]struct{}
+	ranges []*RangeExpression
+	floats []Value // 浮点数元素，与绝对值超过2^53的整数按浮点数比较时使用
+}
+
+/**
+ * @description: 用字面量创建哈希表，有无法精确比较的元素时返回nil
+ * @param {[]Value} values
+ * @return {*}
+ */
+func newValueSet(values []Value) *valueSet {
+	s := &valueSet{m: make(map[Value]struct{}, len(values))}
+	for _, v := range values {
+		// 超过2^53的整数按浮点数和按整数比较的结果可能不同
+		if v.kind == KindInt && (v.i > maxExactFloat || v.i < -maxExactFloat) ||
+			v.kind == KindFloat && math.Abs(v.f) > maxExactFloat {
+			return nil
+		}
+		if key, ok := setKey(v); ok {
+			s.m[key] = struct{}{}
+		}
+		if v.kind == KindFloat {
+			s.floats = append(s.floats, v)
+		}
+	}
+	return s
+}
+
+func setKey(v Value) (Value, bool) {
+	if v.kind == KindFloat {
+		if v.f != v.f {
+			// NaN与任何值都不相等
+			return Value{}, false
+		}
+		if v.f == math.Trunc(v.f) && math.Abs(v.f) <= maxExactFloat {
+			return IntValue(int(v.f)), true
+		}
+	}
+	return v, true
+}
+
+func (s *valueSet) has(v Value) bool {
+	_, ok := s.m[v]
+	return ok
+}
+
+func (s *valueSet) contains(v Value, strict bool) bool {
+	if !strict {
+		v = v.promoteBool()
+	}
+	for _, r := range s.ranges {
+		if inRange(v, r) {
+			return true
+		}
+	}
+	// 整数与浮点数按浮点数比较，超过2^53的整数转换为浮点数时有误差，
+	// 可能等于某个浮点数元素，只能逐个比较.数组中的整数不会超过2^53，不会与它相等
+	if v.kind == KindInt && (v.i > maxExactFloat || v.i < -maxExactFloat) {
+		for _, f := range s.floats {
+			if equals(v, f) {
+				return true
+			}
+		}
+		return false
+	}
+	key, ok := setKey(v)
+	if !ok {
+		return false
+	}
+	if s.has(key) {
+		return true
+	}
+	// 非严格模式下数组中的布尔值等于0和1
+	if !strict && key.kind == KindInt && (key.i == 0 || key.i == 1) {
+		return s.has(BoolValue(key.i == 1))
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package calc
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -11,8 +13,11 @@ const (
 )
 
 var keywords = map[string]int{
-	"var": VAR,
-	"in":  IN,
+	"var":   VAR,
+	"in":    IN,
+	"true":  TRUE,
+	"false": FALSE,
+	"not":   NOT,
 }
 
 type Position struct {
@@ -20,6 +25,20 @@ type Position struct {
 	Column int
 }
 
+// before 是否在q之前
+func (p Position) before(q Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+}
+
+// IsValid 手工构造的语法树节点没有位置信息
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("Line %d, Column %d", p.Line, p.Column)
+}
+
 type Scanner struct {
 	src      []rune
 	offset   int
@@ -35,7 +54,7 @@ func (s *Scanner) Init(src string) {
 	}
 	s.src = []rune(src)
 	//单行脚本自动加分号
-	if !strings.Contains(src, "\n") && s.src[l-1] != ';' {
+	if !strings.Contains(src, "\n") && s.src[len(s.src)-1] != ';' {
 		s.src = append(s.src, ';')
 	}
 }
@@ -52,24 +71,56 @@ func (s *Scanner) Scan() (tok int, lit string, pos Position) {
 			tok = IDENT
 		}
 	case isDigit(ch):
-		tok, lit = NUMBER, s.scanNumber()
+		tok, lit = s.scanNumber()
+	case ch == '"':
+		tok, lit = STRING, s.scanString()
 	default:
 		switch ch {
 		case -1:
 			tok = EOF
-		case '(', ')', ';', '+', '-', '*', '/', '%', '[', ']', ',', '?', ':':
+		case '(', ')', ';', '+', '-', '/', '%', '[', ']', ',', '?', ':', '^', '~':
 			tok = int(ch)
 			lit = string(ch)
 			s.next()
-		case '&':
-			tok = LAND
-			lit = "&&"
+		case '.':
+			if s.peekNext() == '.' {
+				tok = DOTDOT
+				lit = ".."
+				s.next()
+			} else {
+				tok = int(ch)
+				lit = string(ch)
+			}
 			s.next()
+		case '*':
+			if s.peekNext() == '*' {
+				tok = POW
+				lit = "**"
+				s.next()
+			} else {
+				tok = int('*')
+				lit = string(ch)
+			}
 			s.next()
-		case '|':
-			tok = LOR
-			lit = "||"
+		case '&':
+			if s.peekNext() == '&' {
+				tok = LAND
+				lit = "&&"
+				s.next()
+			} else {
+				tok = int('&')
+				lit = string(ch)
+			}
 			s.next()
+		case '|':
+			if s.peekNext() == '|' {
+				tok = LOR
+				lit = "||"
+				s.next()
+			} else {
+				tok = int('|')
+				lit = string(ch)
+			}
 			s.next()
 		case '=':
 			if s.peekNext() == '=' {
@@ -96,6 +147,10 @@ func (s *Scanner) Scan() (tok int, lit string, pos Position) {
 				tok = GE
 				lit = ">="
 				s.next()
+			} else if s.peekNext() == '>' {
+				tok = SHR
+				lit = ">>"
+				s.next()
 			} else {
 				tok = GT
 				lit = ">"
@@ -106,11 +161,20 @@ func (s *Scanner) Scan() (tok int, lit string, pos Position) {
 				tok = LE
 				lit = "<="
 				s.next()
+			} else if s.peekNext() == '<' {
+				tok = SHL
+				lit = "<<"
+				s.next()
 			} else {
 				tok = LT
 				lit = "<"
 			}
 			s.next()
+		default:
+			// 无法识别的字符原样交给parser，由parser报告语法错误
+			tok = int(ch)
+			lit = string(ch)
+			s.next()
 		}
 	}
 	return
@@ -157,6 +221,14 @@ func (s *Scanner) peekNext() rune {
 	}
 }
 
+func (s *Scanner) peekAt(n int) rune {
+	if s.offset+n < len(s.src) {
+		return s.src[s.offset+n]
+	} else {
+		return -1
+	}
+}
+
 func (s *Scanner) next() {
 	if !s.reachEOF() {
 		if s.peek() == '\n' {
@@ -191,13 +263,14 @@ func (s *Scanner) scanIdentifier() string {
 }
 
 /**
- * @description: 解析一个十进制数字或者十六进制数字.如果是十六进制，会自动转成大写
+ * @description: 解析一个十进制数字或者十六进制数字.如果是十六进制，会自动转成大写.
+ * 十进制数字带有小数点或者指数部分时解析为浮点数
  * @param {*}
  * @return {*}
  */
-func (s *Scanner) scanNumber() string {
+func (s *Scanner) scanNumber() (int, string) {
 	var ret []rune
-	if s.peek() == '0' && s.peekNext() == 'x' || s.peekNext() == 'X' {
+	if s.peek() == '0' && (s.peekNext() == 'x' || s.peekNext() == 'X') {
 		ret = append(ret, s.peek())
 		s.next()
 		ret = append(ret, 'X')
@@ -206,8 +279,63 @@ func (s *Scanner) scanNumber() string {
 			ret = append(ret, toUpper(s.peek()))
 			s.next()
 		}
-	} else {
-		for isDigit(s.peek()) {
+		return NUMBER, string(ret)
+	}
+
+	tok := NUMBER
+	ret = s.scanDigits(ret)
+	if s.peek() == '.' && isDigit(s.peekNext()) {
+		tok = FLOAT
+		ret = append(ret, s.peek())
+		s.next()
+		ret = s.scanDigits(ret)
+	}
+	if ch := s.peek(); ch == 'e' || ch == 'E' {
+		// 指数部分形如e10、e+10、e-10
+		n := 1
+		if sign := s.peekAt(n); sign == '+' || sign == '-' {
+			n++
+		}
+		if isDigit(s.peekAt(n)) {
+			tok = FLOAT
+			for ; n > 0; n-- {
+				ret = append(ret, s.peek())
+				s.next()
+			}
+			ret = s.scanDigits(ret)
+		}
+	}
+	return tok, string(ret)
+}
+
+func (s *Scanner) scanDigits(ret []rune) []rune {
+	for isDigit(s.peek()) {
+		ret = append(ret, s.peek())
+		s.next()
+	}
+	return ret
+}
+
+/**
+ * @description: 解析一个双引号括起来的字符串，返回包含引号和转义符的原始文本.
+ * 字符串不能跨行，缺少结尾的引号时返回的文本也没有结尾的引号
+ * @param {*}
+ * @return {*}
+ */
+func (s *Scanner) scanString() string {
+	ret := []rune{s.peek()}
+	s.next()
+	for {
+		ch := s.peek()
+		if ch == -1 || ch == '\n' {
+			break
+		}
+		ret = append(ret, ch)
+		s.next()
+		if ch == '"' {
+			break
+		}
+		if ch == '\\' && s.peek() != -1 && s.peek() != '\n' {
 			ret = append(ret, s.peek())
 			s.next()
 		}
@@ -215,20 +343,46 @@ func (s *Scanner) scanNumber() string {
 	return string(ret)
 }
 
+/**
+ * @description: 去掉字符串字面量的引号并处理转义符，转义规则与Go语言相同
+ * @param {string} lit
+ * @return {*}
+ */
+func toString(lit string) (string, error) {
+	if len(lit) < 2 || lit[len(lit)-1] != '"' {
+		return "", fmt.Errorf("string literal not terminated")
+	}
+	str, err := strconv.Unquote(lit)
+	if err != nil {
+		return "", fmt.Errorf("invalid string literal")
+	}
+	return str, nil
+}
+
+// toNumber 十六进制以0X开头，超出int范围时返回错误
 func toNumber(lit string) (int, error) {
+	base, digits := 10, lit
 	if len(lit) >= 2 && lit[1] == 'X' {
-		src := []rune(lit)
-		val := 0
-		for i := 2; i < len(src); i++ {
-			var ch rune = src[i]
-			if ch >= 'A' {
-				val = val*16 + int(ch)&15 + 9
-			} else {
-				val = val*16 + int(ch)&15
-			}
+		base, digits = 16, lit[2:]
+	}
+	val, err := strconv.ParseInt(digits, base, strconv.IntSize)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, errors.New("integer literal out of range")
 		}
-		return val, nil
-	} else {
-		return strconv.Atoi(lit)
+		return 0, errors.New("invalid integer literal")
+	}
+	return int(val), nil
+}
+
+// toFloat 超出float64范围时返回错误，而不是得到Inf
+func toFloat(lit string) (float64, error) {
+	val, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, errors.New("float literal out of range")
+		}
+		return 0, errors.New("invalid float literal")
 	}
+	return val, nil
 }
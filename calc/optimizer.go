@@ -0,0 +1,260 @@
+package calc
+
+import "context"
+
+/**
+ * @description: 优化语法树，返回与原来等价的新语法树，原来的语法树不会被修改.
+ * 会计算常量表达式(包括var定义的常量和内置函数)、去掉多余的括号、化简逻辑运算，
+ * 并把in后面较大的字面量数组预先放入哈希表.结果依赖于严格模式等设置，应该由同一个求值器求值.
+ * 不合法的语句(见Validate)会被原样保留
+ * @param {[]Statement} statements
+ * @return {*}
+ */
+func (e Evaluator) Optimize(statements []Statement) []Statement {
+	o := &optimizer{eva: e, consts: make(map[string]Value)}
+	ret := make([]Statement, 0, len(statements))
+	for _, stmt := range statements {
+		if validateStmt(stmt) != nil {
+			// 不合法的语句原样保留，求值时再报告错误
+			ret = append(ret, stmt)
+			continue
+		}
+		switch s := stmt.(type) {
+		case *ExpressionStatement:
+			ret = append(ret, &ExpressionStatement{Span: s.Span, Expr: o.expr(s.Expr)})
+		case *VarDefStatement:
+			expr := o.expr(s.Expr)
+			// 后面的语句引用这个变量时直接使用常量，重新定义为非常量时不再替换
+			if v, ok := constValue(expr); ok {
+				o.consts[s.VarName] = v
+			} else {
+				delete(o.consts, s.VarName)
+			}
+			ret = append(ret, &VarDefStatement{Span: s.Span, VarName: s.VarName, Expr: expr})
+		default:
+			ret = append(ret, stmt)
+		}
+	}
+	return ret
+}
+
+type optimizer struct {
+	eva    Evaluator
+	consts map[string]Value // var定义的常量
+}
+
+func constValue(expr Expression) (Value, bool) {
+	switch e := expr.(type) {
+	case *NumberExpression:
+		return IntValue(e.Val), true
+	case *FloatExpression:
+		return FloatValue(e.Val), true
+	case *StringExpression:
+		return StringValue(e.Val), true
+	case *BoolExpression:
+		return BoolValue(e.Val), true
+	}
+	return Value{}, false
+}
+
+// 把常量转换回字面量，位置使用被替换的节点的位置
+func constExpr(v Value, span Span) Expression {
+	switch v.Kind() {
+	case KindInt:
+		return &NumberExpression{Span: span, Val: v.Int()}
+	case KindFloat:
+		return &FloatExpression{Span: span, Val: v.Float()}
+	case KindString:
+		return &StringExpression{Span: span, Val: v.Str()}
+	case KindBool:
+		return &BoolExpression{Span: span, Val: v.Bool()}
+	}
+	return nil
+}
+
+func spanOfNode(node Node) Span {
+	return Span{StartPos: node.Pos(), EndPos: node.End()}
+}
+
+// 结果一定是布尔值的表达式
+func isBoolExpr(expr Expression) bool {
+	switch e := expr.(type) {
+	case *BoolExpression, *BinOpLogicExpression, *UnaryNotExpression, *InExpression, *InSetExpression:
+		return true
+	case *BinOpExpression:
+		switch e.Operator {
+		case EQ, NE, GE, GT, LE, LT:
+			return true
+		}
+	}
+	return false
+}
+
+// 与BinOpLogicExpression对右边的处理相同：求真假后转换为布尔值
+func toBoolExpr(expr Expression, span Span) Expression {
+	if isBoolExpr(expr) {
+		return expr
+	}
+	return &UnaryNotExpression{Span: span, SubExpr: &UnaryNotExpression{Span: span, SubExpr: expr}}
+}
+
+// 对已经优化过的常量表达式求值，出错时不折叠，留到求值时报告错误
+func (o *optimizer) fold(expr Expression) (Expression, bool) {
+	v, err := o.eva.evaluateExpr(context.Background(), expr, Env{})
+	if err != nil {
+		return expr, false
+	}
+	if ret := constExpr(v, spanOfNode(expr)); ret != nil {
+		return ret, true
+	}
+	return expr, false
+}
+
+// 常量作为条件时的真假，严格模式下非布尔值不能作为条件
+func (o *optimizer) condition(expr Expression) (b bool, ok bool) {
+	v, isConst := constValue(expr)
+	if !isConst {
+		return false, false
+	}
+	b, err := o.eva.condition(expr, v)
+	return b, err == nil
+}
+
+func (o *optimizer) exprs(list []Expression) ([]Expression, bool) {
+	ret := make([]Expression, len(list))
+	allConst := true
+	for i, x := range list {
+		ret[i] = o.expr(x)
+		_, isConst := constValue(ret[i])
+		_, isRange := ret[i].(*RangeExpression)
+		allConst = allConst && (isConst || isRange)
+	}
+	return ret, allConst
+}
+
+func (o *optimizer) expr(expr Expression) Expression {
+	switch e := expr.(type) {
+	case *IdentifierExpression:
+		if v, ok := o.consts[e.Lit]; ok {
+			return constExpr(v, e.Span)
+		}
+		return e
+	case *ParenExpression:
+		return o.expr(e.SubExpr)
+	case *UnaryMinusExpression:
+		ret := &UnaryMinusExpression{Span: e.Span, SubExpr: o.expr(e.SubExpr)}
+		if _, ok := constValue(ret.SubExpr); ok {
+			folded, _ := o.fold(ret)
+			return folded
+		}
+		return ret
+	case *UnaryBitNotExpression:
+		ret := &UnaryBitNotExpression{Span: e.Span, SubExpr: o.expr(e.SubExpr)}
+		if _, ok := constValue(ret.SubExpr); ok {
+			folded, _ := o.fold(ret)
+			return folded
+		}
+		return ret
+	case *UnaryNotExpression:
+		sub := o.expr(e.SubExpr)
+		if b, ok := o.condition(sub); ok {
+			return &BoolExpression{Span: e.Span, Val: !b}
+		}
+		// !(x in [...])等价于x not in [...]
+		switch in := sub.(type) {
+		case *InExpression:
+			return &InExpression{Span: e.Span, LHS: in.LHS, Arr: in.Arr, Not: !in.Not, RHS: in.RHS}
+		case *InSetExpression:
+			return &InSetExpression{Span: e.Span, LHS: in.LHS, Arr: in.Arr, Not: !in.Not, set: in.set}
+		}
+		// !!x等价于x
+		if not, ok := sub.(*UnaryNotExpression); ok && isBoolExpr(not.SubExpr) {
+			return not.SubExpr
+		}
+		return &UnaryNotExpression{Span: e.Span, SubExpr: sub}
+	case *BinOpExpression:
+		ret := &BinOpExpression{Span: e.Span, LHS: o.expr(e.LHS), Operator: e.Operator, RHS: o.expr(e.RHS)}
+		lhsV, lok := constValue(ret.LHS)
+		rhsV, rok := constValue(ret.RHS)
+		if !lok || !rok {
+			return ret
+		}
+		if (ret.Operator == '/' || ret.Operator == '%') && rhsV.Kind() == KindInt && rhsV.Int() == 0 && lhsV.Kind() == KindInt {
+			// 整数除以0留到求值时处理
+			return ret
+		}
+		folded, _ := o.fold(ret)
+		return folded
+	case *BinOpLogicExpression:
+		return o.logic(e)
+	case *TernaryExpression:
+		cond := o.expr(e.Cond)
+		if b, ok := o.condition(cond); ok {
+			if b {
+				return o.expr(e.TrueExpr)
+			}
+			return o.expr(e.FalseExpr)
+		}
+		return &TernaryExpression{Span: e.Span, Cond: cond, TrueExpr: o.expr(e.TrueExpr), FalseExpr: o.expr(e.FalseExpr)}
+	case *ArrayExpression:
+		arr, _ := o.exprs(e.Arr)
+		return &ArrayExpression{Span: e.Span, Arr: arr}
+	case *InExpression:
+		lhs := o.expr(e.LHS)
+		if e.RHS != nil {
+			return &InExpression{Span: e.Span, LHS: lhs, Not: e.Not, RHS: o.expr(e.RHS)}
+		}
+		arr, allConst := o.exprs(e.Arr)
+		ret := &InExpression{Span: e.Span, LHS: lhs, Arr: arr, Not: e.Not}
+		if !allConst {
+			return ret
+		}
+		if _, ok := constValue(lhs); ok {
+			folded, _ := o.fold(ret)
+			return folded
+		}
+		return newInExpression(e.Span, lhs, arr, e.Not)
+	case *InSetExpression:
+		ret := &InSetExpression{Span: e.Span, LHS: o.expr(e.LHS), Arr: e.Arr, Not: e.Not, set: e.set}
+		if _, ok := constValue(ret.LHS); ok {
+			folded, _ := o.fold(ret)
+			return folded
+		}
+		return ret
+	case *CallExpression:
+		args, allConst := o.exprs(e.Args)
+		ret := &CallExpression{Span: e.Span, Name: e.Name, Args: args}
+		// 只有内置函数没有副作用，注册的函数和带参数的条件每次都要调用
+		if fn, ok := builtins[e.Name]; ok && allConst && o.eva.lookupFunc(e.Name) == fn {
+			folded, _ := o.fold(ret)
+			return folded
+		}
+		return ret
+	}
+	return expr
+}
+
+/**
+ * @description: 化简逻辑运算，常量在左边时可以直接确定结果或者只保留右边，
+ * 右边为true(&&)或false(||)时只保留左边
+ * @param {*BinOpLogicExpression} e
+ * @return {*}
+ */
+func (o *optimizer) logic(e *BinOpLogicExpression) Expression {
+	lhs, rhs := o.expr(e.LHS), o.expr(e.RHS)
+	isAnd := e.Operator == LAND
+	if b, ok := o.condition(lhs); ok {
+		if b != isAnd {
+			// false && x为false，true || x为true，x不会被求值
+			return &BoolExpression{Span: e.Span, Val: b}
+		}
+		if rb, ok := o.condition(rhs); ok {
+			return &BoolExpression{Span: e.Span, Val: rb}
+		}
+		return toBoolExpr(rhs, e.Span)
+	}
+	if b, ok := o.condition(rhs); ok && b == isAnd {
+		return toBoolExpr(lhs, e.Span)
+	}
+	return &BinOpLogicExpression{Span: e.Span, LHS: lhs, Operator: e.Operator, RHS: rhs}
+}
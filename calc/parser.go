@@ -3,15 +3,30 @@ package calc
 
 import __yyfmt__ "fmt"
 
-import (
-	"log"
-)
-
 type Token struct {
-	tok int
-	lit string
-	val int
-	pos Position
+	tok  int
+	lit  string
+	val  int
+	fval float64
+	sval string
+	pos  Position
+	end  Position
+}
+
+func (t Token) span() Span {
+	return Span{StartPos: t.pos, EndPos: t.end}
+}
+
+func spanOf(start, end Position) Span {
+	return Span{StartPos: start, EndPos: end}
+}
+
+// in后面是数组字面量时逐个比较元素，否则求值时再判断结果是否为数组
+func newIn(span Span, lhs, rhs Expression, not bool) Expression {
+	if arr, ok := rhs.(*ArrayExpression); ok {
+		return newInExpression(span, lhs, arr.Arr, not)
+	}
+	return &InExpression{Span: span, LHS: lhs, Not: not, RHS: rhs}
 }
 
 type yySymType struct {
@@ -20,22 +35,32 @@ type yySymType struct {
 	statement  Statement
 	expr       Expression
 	tok        Token
-	arr        []NumberExpression
+	arr        []Expression
+	array      *ArrayExpression
 }
 
 const IDENT = 57346
 const NUMBER = 57347
-const VAR = 57348
-const LOR = 57349
-const LAND = 57350
-const EQ = 57351
-const NE = 57352
-const LE = 57353
-const LT = 57354
-const GE = 57355
-const GT = 57356
-const IN = 57357
-const UNARY = 57358
+const FLOAT = 57348
+const STRING = 57349
+const TRUE = 57350
+const FALSE = 57351
+const VAR = 57352
+const NOT = 57353
+const DOTDOT = 57354
+const SHL = 57355
+const SHR = 57356
+const POW = 57357
+const LOR = 57358
+const LAND = 57359
+const EQ = 57360
+const NE = 57361
+const LE = 57362
+const LT = 57363
+const GE = 57364
+const GT = 57365
+const IN = 57366
+const UNARY = 57367
 
 var yyToknames = [...]string{
 	"$end",
@@ -43,7 +68,16 @@ var yyToknames = [...]string{
 	"$unk",
 	"IDENT",
 	"NUMBER",
+	"FLOAT",
+	"STRING",
+	"TRUE",
+	"FALSE",
 	"VAR",
+	"NOT",
+	"DOTDOT",
+	"SHL",
+	"SHR",
+	"POW",
 	"'?'",
 	"':'",
 	"LOR",
@@ -58,15 +92,19 @@ var yyToknames = [...]string{
 	"','",
 	"'+'",
 	"'-'",
+	"'|'",
+	"'^'",
 	"'*'",
 	"'/'",
 	"'%'",
+	"'&'",
 	"UNARY",
 	"';'",
 	"'='",
-	"'!'",
 	"'('",
 	"')'",
+	"'!'",
+	"'~'",
 	"'['",
 	"']'",
 }
@@ -82,175 +120,293 @@ type LexerWrapper struct {
 	recentLit  string
 	recentPos  Position
 	statements []Statement
+	errs       ParseErrorList
+	checked    int // 已经检查过属于哪条语句的错误个数
+}
+
+/**
+ * @description: 字面量不合法时语句仍然会被归约，但是不算解析成功.
+ * 检查上一条语句之后记录的、位于这条语句中的错误
+ * @param {Statement} stmt 出错后恢复的语句为nil
+ * @return {*} 语句是否应该被丢弃
+ */
+func (l *LexerWrapper) dropStatement(stmt Statement) bool {
+	if stmt == nil {
+		l.checked = len(l.errs)
+		return true
+	}
+	drop := false
+	for ; l.checked < len(l.errs) && l.errs[l.checked].Position.before(stmt.End()); l.checked++ {
+		drop = true
+	}
+	return drop
+}
+
+func init() {
+	// 需要goyacc给出期望的token列表
+	yyErrorVerbose = true
 }
 
 func (l *LexerWrapper) Lex(lval *yySymType) int {
 	tok, lit, pos := l.s.Scan()
+	l.recentLit = lit
+	l.recentPos = pos
 	if tok == EOF {
 		return 0
 	}
-	lval.tok = Token{tok: tok, lit: lit, pos: pos}
-	if tok == NUMBER {
-		lval.tok.val, _ = toNumber(lit)
+	// Scan结束时扫描器恰好停在token末尾
+	lval.tok = Token{tok: tok, lit: lit, pos: pos, end: l.s.position()}
+	var err error
+	switch tok {
+	case NUMBER:
+		lval.tok.val, err = toNumber(lit)
+	case FLOAT:
+		lval.tok.fval, err = toFloat(lit)
+	case STRING:
+		lval.tok.sval, err = toString(lit)
+	}
+	if err != nil {
+		l.errs = append(l.errs, newParseError(pos, lit, err.Error()))
 	}
-	l.recentLit = lit
-	l.recentPos = pos
 	return tok
 }
 
 func (l *LexerWrapper) Error(e string) {
-	err := __yyfmt__.Sprintf("Line %d, Column %d: %q %s",
-		l.recentPos.Line, l.recentPos.Column, l.recentLit, e)
-	log.Print(err)
-	panic(err)
+	l.errs = append(l.errs, newParseError(l.recentPos, l.recentLit, e))
 }
 
-func Parse(s *Scanner) []Statement {
+/**
+ * @description: 解析脚本，遇到语法错误时会跳过出错的语句继续解析，
+ * 返回所有解析成功的语句以及所有的语法错误
+ * @param {*Scanner} s
+ * @return {*}
+ */
+func ParseAll(s *Scanner) ([]Statement, ParseErrorList) {
 	l := LexerWrapper{s: s}
-	if yyParse(&l) != 0 {
-		panic("Parse error")
+	if yyParse(&l) != 0 && len(l.errs) == 0 {
+		l.errs = append(l.errs, newParseError(l.recentPos, l.recentLit, "syntax error"))
+	}
+	return l.statements, l.errs
+}
+
+/**
+ * @description: 解析脚本，遇到语法错误时返回第一个*ParseError
+ * @param {*Scanner} s
+ * @return {*}
+ */
+func ParseE(s *Scanner) ([]Statement, error) {
+	statements, errs := ParseAll(s)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return statements, nil
+}
+
+/**
+ * @description: 解析脚本，遇到语法错误时panic，错误值为*ParseError
+ * @param {*Scanner} s
+ * @return {*}
+ */
+func Parse(s *Scanner) []Statement {
+	statements, err := ParseE(s)
+	if err != nil {
+		panic(err)
 	}
-	return l.statements
+	return statements
 }
 
 var yyExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 36,
-	11, 0,
-	12, 0,
-	13, 0,
-	14, 0,
-	15, 0,
-	16, 0,
-	-2, 14,
-	-1, 37,
-	11, 0,
-	12, 0,
-	13, 0,
-	14, 0,
-	15, 0,
-	16, 0,
-	-2, 15,
-	-1, 38,
-	11, 0,
-	12, 0,
-	13, 0,
-	14, 0,
-	15, 0,
-	16, 0,
-	-2, 16,
-	-1, 39,
-	11, 0,
-	12, 0,
-	13, 0,
-	14, 0,
-	15, 0,
-	16, 0,
-	-2, 17,
-	-1, 40,
-	11, 0,
-	12, 0,
-	13, 0,
-	14, 0,
-	15, 0,
-	16, 0,
-	-2, 18,
-	-1, 41,
-	11, 0,
-	12, 0,
-	13, 0,
-	14, 0,
-	15, 0,
-	16, 0,
-	-2, 19,
+	-1, 55,
+	12, 43,
+	-2, 47,
+	-1, 61,
+	20, 0,
+	21, 0,
+	22, 0,
+	23, 0,
+	24, 0,
+	25, 0,
+	-2, 20,
+	-1, 62,
+	20, 0,
+	21, 0,
+	22, 0,
+	23, 0,
+	24, 0,
+	25, 0,
+	-2, 21,
+	-1, 63,
+	20, 0,
+	21, 0,
+	22, 0,
+	23, 0,
+	24, 0,
+	25, 0,
+	-2, 22,
+	-1, 64,
+	20, 0,
+	21, 0,
+	22, 0,
+	23, 0,
+	24, 0,
+	25, 0,
+	-2, 23,
+	-1, 65,
+	20, 0,
+	21, 0,
+	22, 0,
+	23, 0,
+	24, 0,
+	25, 0,
+	-2, 24,
+	-1, 66,
+	20, 0,
+	21, 0,
+	22, 0,
+	23, 0,
+	24, 0,
+	25, 0,
+	-2, 25,
+	-1, 86,
+	12, 44,
+	-2, 47,
 }
 
 const yyPrivate = 57344
 
-const yyLast = 175
+const yyLast = 432
 
 var yyAct = [...]int8{
-	3, 56, 52, 33, 47, 24, 25, 26, 28, 29,
-	30, 58, 27, 31, 55, 34, 35, 36, 37, 38,
-	39, 40, 41, 42, 43, 44, 45, 46, 51, 12,
-	50, 15, 14, 16, 17, 18, 19, 20, 21, 13,
-	32, 22, 23, 24, 25, 26, 1, 2, 53, 10,
-	54, 48, 12, 0, 15, 14, 16, 17, 18, 19,
-	20, 21, 13, 0, 22, 23, 24, 25, 26, 12,
-	57, 15, 14, 16, 17, 18, 19, 20, 21, 13,
-	0, 22, 23, 24, 25, 26, 0, 11, 12, 49,
-	15, 14, 16, 17, 18, 19, 20, 21, 13, 0,
-	22, 23, 24, 25, 26, 15, 14, 16, 17, 18,
-	19, 20, 21, 13, 0, 22, 23, 24, 25, 26,
-	14, 16, 17, 18, 19, 20, 21, 13, 0, 22,
-	23, 24, 25, 26, 16, 17, 18, 19, 20, 21,
-	13, 0, 22, 23, 24, 25, 26, 6, 5, 4,
-	6, 5, 13, 0, 22, 23, 24, 25, 26, 0,
-	0, 0, 0, 8, 0, 0, 8, 0, 0, 0,
-	7, 9, 0, 7, 9,
+	46, 53, 3, 84, 51, 91, 44, 78, 43, 58,
+	45, 39, 47, 48, 85, 99, 42, 8, 90, 52,
+	83, 56, 57, 94, 59, 60, 61, 62, 63, 64,
+	65, 66, 67, 68, 69, 70, 71, 72, 73, 74,
+	75, 76, 77, 80, 49, 81, 6, 95, 2, 1,
+	0, 0, 0, 22, 0, 40, 41, 39, 20, 88,
+	24, 23, 25, 26, 27, 28, 29, 30, 21, 0,
+	31, 32, 37, 38, 33, 34, 35, 36, 0, 89,
+	0, 0, 82, 0, 0, 52, 0, 93, 96, 92,
+	0, 22, 98, 40, 41, 39, 20, 0, 24, 23,
+	25, 26, 27, 28, 29, 30, 21, 0, 31, 32,
+	37, 38, 33, 34, 35, 36, 22, 97, 40, 41,
+	39, 20, 0, 24, 23, 25, 26, 27, 28, 29,
+	30, 21, 0, 31, 32, 37, 38, 33, 34, 35,
+	36, 22, 19, 40, 41, 39, 20, 87, 24, 23,
+	25, 26, 27, 28, 29, 30, 21, 0, 31, 32,
+	37, 38, 33, 34, 35, 36, 22, 0, 40, 41,
+	39, 20, 0, 24, 23, 25, 26, 27, 28, 29,
+	30, 21, 0, 31, 32, 37, 38, 33, 34, 35,
+	36, 22, 0, 40, 41, 39, 0, 0, 24, 23,
+	25, 26, 27, 28, 29, 30, 21, 0, 31, 32,
+	37, 38, 33, 34, 35, 36, 7, 55, 14, 15,
+	16, 17, 5, 0, 7, 13, 14, 15, 16, 17,
+	4, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 54, 0, 0, 0, 0, 0, 0, 0, 10,
+	0, 12, 0, 9, 11, 18, 50, 0, 0, 12,
+	0, 9, 11, 18, 22, 0, 40, 41, 39, 0,
+	0, 0, 23, 25, 26, 27, 28, 29, 30, 21,
+	0, 31, 32, 37, 38, 33, 34, 35, 36, 7,
+	13, 14, 15, 16, 17, 7, 13, 14, 15, 16,
+	17, 0, 0, 0, 7, 55, 14, 15, 16, 17,
+	0, 0, 0, 0, 10, 0, 40, 41, 39, 0,
+	10, 0, 0, 0, 12, 79, 9, 11, 18, 54,
+	12, 0, 9, 11, 18, 33, 34, 35, 36, 12,
+	0, 9, 11, 18, 22, 0, 40, 41, 39, 0,
+	0, 0, 0, 25, 26, 27, 28, 29, 30, 21,
+	0, 31, 32, 37, 38, 33, 34, 35, 36, 7,
+	86, 14, 15, 16, 17, 0, 0, 0, 22, 0,
+	40, 41, 39, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 21, 10, 31, 32, 37, 38, 33,
+	34, 35, 36, 0, 12, 0, 9, 11, 18, 40,
+	41, 39, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 31, 32, 37, 38, 33, 34,
+	35, 36,
 }
 
 var yyPact = [...]int16{
-	143, -1000, 143, 62, 8, -1000, -1000, 146, 146, 146,
-	-1000, -1000, 146, -27, 146, 146, 146, 146, 146, 146,
-	146, 146, 146, 146, 146, 146, 146, -22, -1000, -1000,
-	22, 81, -1000, -3, 123, 110, 135, 135, 135, 135,
-	135, 135, -16, -16, -1000, -1000, -1000, 146, -1000, 146,
-	-17, -1000, -1000, 45, 96, -1000, 6, -1000, -1000,
+	-32768, 220, -32768, 105, 12, -29, -32768, -33, -32768, 291,
+	291, 291, 291, -32768, -32768, -32768, -32768, -32768, 212, -32768,
+	291, 291, -17, 291, 291, 291, 291, 291, 291, 291,
+	291, 291, 291, 291, 291, 291, 291, 291, 291, 291,
+	291, 291, -31, -32768, 285, -4, -4, -4, 42, -24,
+	-32768, -32768, 155, 2, 365, -32768, 130, 396, 291, 333,
+	253, 367, 367, 367, 367, 367, 367, 303, 303, -4,
+	-4, -4, -4, 303, 303, -4, -4, -4, 291, -32768,
+	-22, 155, -32768, -32768, 300, 18, -32768, 291, 396, 80,
+	-32768, 291, -32768, -32768, -32768, 10, 180, -32768, 155, -32768,
 }
 
 var yyPgo = [...]int8{
-	0, 46, 47, 0, 40, 30,
+	0, 49, 48, 0, 46, 4, 44, 43, 17, 1,
 }
 
 var yyR1 = [...]int8{
-	0, 1, 1, 2, 2, 3, 3, 3, 3, 3,
+	0, 1, 1, 2, 2, 2, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 4, 4, 5, 5,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 8, 8, 6,
+	6, 5, 5, 9, 9, 7, 7, 4, 4, 4,
+	4, 4,
 }
 
 var yyR2 = [...]int8{
-	0, 0, 2, 2, 5, 1, 1, 5, 3, 2,
-	2, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 2, 1, 3,
+	0, 0, 2, 2, 5, 2, 1, 1, 3, 4,
+	5, 1, 3, 4, 2, 2, 2, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 2, 1,
+	3, 1, 3, 1, 2, 1, 3, 1, 1, 1,
+	1, 1,
 }
 
 var yyChk = [...]int16{
-	-1000, -1, -2, -3, 6, 5, 4, 27, 20, 28,
-	-1, 25, 7, 17, 10, 9, 11, 12, 13, 14,
-	15, 16, 19, 20, 21, 22, 23, 4, -3, -3,
-	-3, -3, -4, 30, -3, -3, -3, -3, -3, -3,
-	-3, -3, -3, -3, -3, -3, -3, 26, 29, 8,
-	-5, 31, 5, -3, -3, 31, 18, 25, 5,
+	-32768, -1, -2, -3, 10, 2, -4, 4, -8, 41,
+	29, 42, 39, 5, 6, 7, 8, 9, 43, 37,
+	16, 26, 11, 19, 18, 20, 21, 22, 23, 24,
+	25, 28, 29, 32, 33, 34, 35, 30, 31, 15,
+	13, 14, 4, 37, 39, -3, -3, -3, -3, -6,
+	44, -5, -3, -9, 29, 5, -3, -3, 26, -3,
+	-3, -3, -3, -3, -3, -3, -3, -3, -3, -3,
+	-3, -3, -3, -3, -3, -3, -3, -3, 38, 40,
+	-7, -3, 40, 44, 27, 12, 5, 17, -3, -3,
+	40, 27, -5, -9, 5, 29, -3, 37, -3, 5,
 }
 
 var yyDef = [...]int8{
-	1, -2, 1, 0, 0, 5, 6, 0, 0, 0,
-	2, 3, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 9, 10,
-	0, 0, 8, 0, 12, 13, -2, -2, -2, -2,
-	-2, -2, 20, 21, 22, 23, 24, 0, 11, 0,
-	0, 26, 27, 0, 7, 25, 0, 4, 28,
+	1, -2, 2, 0, 0, 0, 6, 7, 11, 0,
+	0, 0, 0, 47, 48, 49, 50, 51, 0, 3,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 5, 0, 14, 15, 16, 0, 0,
+	38, 39, 41, 0, 0, -2, 0, 12, 0, 18,
+	19, -2, -2, -2, -2, -2, -2, 26, 27, 28,
+	29, 30, 31, 32, 33, 34, 35, 36, 0, 8,
+	0, 45, 17, 37, 0, 0, -2, 0, 13, 0,
+	9, 0, 40, 42, 43, 0, 10, 4, 46, 44,
 }
 
 var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 27, 3, 3, 3, 23, 3, 3,
-	28, 29, 21, 19, 18, 20, 3, 22, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 8, 25,
-	3, 26, 3, 7, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 41, 3, 3, 3, 34, 35, 3,
+	39, 40, 32, 28, 27, 29, 3, 33, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 17, 37,
+	3, 38, 3, 16, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 30, 3, 31,
+	3, 43, 3, 44, 31, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 30, 3, 42,
 }
 
 var yyTok2 = [...]int8{
-	2, 3, 4, 5, 6, 9, 10, 11, 12, 13,
-	14, 15, 16, 17, 24,
+	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+	12, 13, 14, 15, 18, 19, 20, 21, 22, 23,
+	24, 25, 26, 36,
 }
 
 var yyTok3 = [...]int8{
@@ -294,7 +450,7 @@ func yyNewParser() yyParser {
 	return &yyParserImpl{}
 }
 
-const yyFlag = -1000
+const yyFlag = -32768
 
 func yyTokname(c int) string {
 	if c >= 1 && c-1 < len(yyToknames) {
@@ -603,140 +759,254 @@ yydefault:
 	case 2:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
-			yyVAL.statements = append([]Statement{yyDollar[1].statement}, yyDollar[2].statements...)
-			if l, isLexerWrapper := yylex.(*LexerWrapper); isLexerWrapper {
+			yyVAL.statements = yyDollar[1].statements
+			l, isLexerWrapper := yylex.(*LexerWrapper)
+			if isLexerWrapper {
+				if !l.dropStatement(yyDollar[2].statement) {
+					yyVAL.statements = append(yyVAL.statements, yyDollar[2].statement)
+				}
 				l.statements = yyVAL.statements
+			} else if yyDollar[2].statement != nil {
+				yyVAL.statements = append(yyVAL.statements, yyDollar[2].statement)
 			}
 		}
 	case 3:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
-			yyVAL.statement = &ExpressionStatement{Expr: yyDollar[1].expr}
+			yyVAL.statement = &ExpressionStatement{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[2].tok.end), Expr: yyDollar[1].expr}
 		}
 	case 4:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
-			yyVAL.statement = &VarDefStatement{VarName: yyDollar[2].tok.lit, Expr: yyDollar[4].expr}
+			yyVAL.statement = &VarDefStatement{Span: spanOf(yyDollar[1].tok.pos, yyDollar[5].tok.end), VarName: yyDollar[2].tok.lit, Expr: yyDollar[4].expr}
 		}
 	case 5:
-		yyDollar = yyS[yypt-1 : yypt+1]
-		{
-			yyVAL.expr = &NumberExpression{Val: yyDollar[1].tok.val}
-		}
-	case 6:
-		yyDollar = yyS[yypt-1 : yypt+1]
+		yyDollar = yyS[yypt-2 : yypt+1]
 		{
-			yyVAL.expr = &IdentifierExpression{Lit: yyDollar[1].tok.lit}
+			yyVAL.statement = nil
 		}
 	case 7:
-		yyDollar = yyS[yypt-5 : yypt+1]
+		yyDollar = yyS[yypt-1 : yypt+1]
 		{
-			yyVAL.expr = &TernaryExpression{Cond: yyDollar[1].expr, TrueExpr: yyDollar[3].expr, FalseExpr: yyDollar[5].expr}
+			yyVAL.expr = &IdentifierExpression{Span: yyDollar[1].tok.span(), Lit: yyDollar[1].tok.lit}
 		}
 	case 8:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &InExpression{LHS: yyDollar[1].expr, Arr: yyDollar[3].arr}
+			yyVAL.expr = &CallExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[3].tok.end), Name: yyDollar[1].tok.lit}
 		}
 	case 9:
-		yyDollar = yyS[yypt-2 : yypt+1]
+		yyDollar = yyS[yypt-4 : yypt+1]
 		{
-			yyVAL.expr = &UnaryNotExpression{SubExpr: yyDollar[2].expr}
+			yyVAL.expr = &CallExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[4].tok.end), Name: yyDollar[1].tok.lit, Args: yyDollar[3].arr}
 		}
 	case 10:
-		yyDollar = yyS[yypt-2 : yypt+1]
+		yyDollar = yyS[yypt-5 : yypt+1]
 		{
-			yyVAL.expr = &UnaryMinusExpression{SubExpr: yyDollar[2].expr}
+			yyVAL.expr = &TernaryExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[5].expr.End()), Cond: yyDollar[1].expr, TrueExpr: yyDollar[3].expr, FalseExpr: yyDollar[5].expr}
 		}
 	case 11:
-		yyDollar = yyS[yypt-3 : yypt+1]
+		yyDollar = yyS[yypt-1 : yypt+1]
 		{
-			yyVAL.expr = &ParenExpression{SubExpr: yyDollar[2].expr}
+			yyVAL.expr = yyDollar[1].array
 		}
 	case 12:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpLogicExpression{LHS: yyDollar[1].expr, Operator: LAND, RHS: yyDollar[3].expr}
+			yyVAL.expr = newIn(spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), yyDollar[1].expr, yyDollar[3].expr, false)
 		}
 	case 13:
-		yyDollar = yyS[yypt-3 : yypt+1]
+		yyDollar = yyS[yypt-4 : yypt+1]
 		{
-			yyVAL.expr = &BinOpLogicExpression{LHS: yyDollar[1].expr, Operator: LOR, RHS: yyDollar[3].expr}
+			yyVAL.expr = newIn(spanOf(yyDollar[1].expr.Pos(), yyDollar[4].expr.End()), yyDollar[1].expr, yyDollar[4].expr, true)
 		}
 	case 14:
-		yyDollar = yyS[yypt-3 : yypt+1]
+		yyDollar = yyS[yypt-2 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: EQ, RHS: yyDollar[3].expr}
+			yyVAL.expr = &UnaryNotExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[2].expr.End()), SubExpr: yyDollar[2].expr}
 		}
 	case 15:
-		yyDollar = yyS[yypt-3 : yypt+1]
+		yyDollar = yyS[yypt-2 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: NE, RHS: yyDollar[3].expr}
+			yyVAL.expr = &UnaryMinusExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[2].expr.End()), SubExpr: yyDollar[2].expr}
 		}
 	case 16:
-		yyDollar = yyS[yypt-3 : yypt+1]
+		yyDollar = yyS[yypt-2 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: LE, RHS: yyDollar[3].expr}
+			yyVAL.expr = &UnaryBitNotExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[2].expr.End()), SubExpr: yyDollar[2].expr}
 		}
 	case 17:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: LT, RHS: yyDollar[3].expr}
+			yyVAL.expr = &ParenExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[3].tok.end), SubExpr: yyDollar[2].expr}
 		}
 	case 18:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: GE, RHS: yyDollar[3].expr}
+			yyVAL.expr = &BinOpLogicExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: LAND, RHS: yyDollar[3].expr}
 		}
 	case 19:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: GT, RHS: yyDollar[3].expr}
+			yyVAL.expr = &BinOpLogicExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: LOR, RHS: yyDollar[3].expr}
 		}
 	case 20:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: int('+'), RHS: yyDollar[3].expr}
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: EQ, RHS: yyDollar[3].expr}
 		}
 	case 21:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: int('-'), RHS: yyDollar[3].expr}
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: NE, RHS: yyDollar[3].expr}
 		}
 	case 22:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: int('*'), RHS: yyDollar[3].expr}
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: LE, RHS: yyDollar[3].expr}
 		}
 	case 23:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: int('/'), RHS: yyDollar[3].expr}
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: LT, RHS: yyDollar[3].expr}
 		}
 	case 24:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.expr = &BinOpExpression{LHS: yyDollar[1].expr, Operator: int('%'), RHS: yyDollar[3].expr}
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: GE, RHS: yyDollar[3].expr}
 		}
 	case 25:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.arr = yyDollar[2].arr
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: GT, RHS: yyDollar[3].expr}
 		}
 	case 26:
-		yyDollar = yyS[yypt-2 : yypt+1]
+		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: int('+'), RHS: yyDollar[3].expr}
 		}
 	case 27:
-		yyDollar = yyS[yypt-1 : yypt+1]
+		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.arr = []NumberExpression{NumberExpression{Val: yyDollar[1].tok.val}}
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: int('-'), RHS: yyDollar[3].expr}
 		}
 	case 28:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.arr = append(yyDollar[1].arr, NumberExpression{Val: yyDollar[3].tok.val})
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: int('*'), RHS: yyDollar[3].expr}
+		}
+	case 29:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: int('/'), RHS: yyDollar[3].expr}
+		}
+	case 30:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: int('%'), RHS: yyDollar[3].expr}
+		}
+	case 31:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: int('&'), RHS: yyDollar[3].expr}
+		}
+	case 32:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: int('|'), RHS: yyDollar[3].expr}
+		}
+	case 33:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: int('^'), RHS: yyDollar[3].expr}
+		}
+	case 34:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: POW, RHS: yyDollar[3].expr}
+		}
+	case 35:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: SHL, RHS: yyDollar[3].expr}
+		}
+	case 36:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.expr = &BinOpExpression{Span: spanOf(yyDollar[1].expr.Pos(), yyDollar[3].expr.End()), LHS: yyDollar[1].expr, Operator: SHR, RHS: yyDollar[3].expr}
+		}
+	case 37:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.array = &ArrayExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[3].tok.end), Arr: yyDollar[2].arr}
+		}
+	case 38:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.array = &ArrayExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[2].tok.end)}
+		}
+	case 39:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.arr = []Expression{yyDollar[1].expr}
+		}
+	case 40:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.arr = append(yyDollar[1].arr, yyDollar[3].expr)
+		}
+	case 42:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			if yyDollar[1].tok.val > yyDollar[3].tok.val {
+				if l, isLexerWrapper := yylex.(*LexerWrapper); isLexerWrapper {
+					l.errs = append(l.errs, newParseError(yyDollar[1].tok.pos, yyDollar[1].tok.lit+".."+yyDollar[3].tok.lit, "invalid range: lower bound is greater than upper bound"))
+				}
+			}
+			yyVAL.expr = &RangeExpression{Span: spanOf(yyDollar[1].tok.pos, yyDollar[3].tok.end), Low: yyDollar[1].tok.val, High: yyDollar[3].tok.val}
+		}
+	case 44:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.tok = yyDollar[2].tok
+			yyVAL.tok.val = -yyDollar[2].tok.val
+			yyVAL.tok.lit = "-" + yyDollar[2].tok.lit
+			yyVAL.tok.pos = yyDollar[1].tok.pos
+		}
+	case 45:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.arr = []Expression{yyDollar[1].expr}
+		}
+	case 46:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.arr = append(yyDollar[1].arr, yyDollar[3].expr)
+		}
+	case 47:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.expr = &NumberExpression{Span: yyDollar[1].tok.span(), Val: yyDollar[1].tok.val}
+		}
+	case 48:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.expr = &FloatExpression{Span: yyDollar[1].tok.span(), Val: yyDollar[1].tok.fval}
+		}
+	case 49:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.expr = &StringExpression{Span: yyDollar[1].tok.span(), Val: yyDollar[1].tok.sval}
+		}
+	case 50:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.expr = &BoolExpression{Span: yyDollar[1].tok.span(), Val: true}
+		}
+	case 51:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.expr = &BoolExpression{Span: yyDollar[1].tok.span(), Val: false}
 		}
 	}
 	goto yystack /* stack new state and value */
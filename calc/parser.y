@@ -2,15 +2,30 @@
 %{
 package calc
 
-import (
-	"log"
-)
-
 type Token struct {
-	tok int
-	lit string
-	val int
-	pos Position
+	tok  int
+	lit  string
+	val  int
+	fval float64
+	sval string
+	pos  Position
+	end  Position
+}
+
+func (t Token) span() Span {
+	return Span{StartPos: t.pos, EndPos: t.end}
+}
+
+func spanOf(start, end Position) Span {
+	return Span{StartPos: start, EndPos: end}
+}
+
+// in后面是数组字面量时逐个比较元素，否则求值时再判断结果是否为数组
+func newIn(span Span, lhs, rhs Expression, not bool) Expression {
+	if arr, ok := rhs.(*ArrayExpression); ok {
+		return newInExpression(span, lhs, arr.Arr, not)
+	}
+	return &InExpression{Span: span, LHS: lhs, Not: not, RHS: rhs}
 }
 
 %}
@@ -20,15 +35,18 @@ type Token struct {
 	statement  Statement
 	expr       Expression
 	tok        Token
-	arr        []NumberExpression
+	arr        []Expression
+	array      *ArrayExpression
 }
 
 %type<statements> statements
 %type<statement> statement
-%type<expr> expr
-%type<arr> array array_element 
+%type<expr> expr literal element
+%type<arr> array_element arguments
+%type<array> array
+%type<tok> range_bound
 
-%token<tok> IDENT NUMBER VAR 
+%token<tok> IDENT NUMBER FLOAT STRING TRUE FALSE VAR NOT DOTDOT SHL SHR POW
 
 /* conditional operator TernaryExpression */
 %left '?' ':'
@@ -36,11 +54,14 @@ type Token struct {
 %left LAND
 %nonassoc EQ NE LE LT GE GT
 /* 判断元素是否存在于数组中 */
-%left IN
+%left IN NOT
 %left ','
-%left '+' '-'
-%left '*' '/' '%'
+/* 位运算的优先级与Go语言相同，flags & 4 != 0等价于(flags & 4) != 0 */
+%left '+' '-' '|' '^'
+%left '*' '/' '%' '&' SHL SHR
 %right UNARY
+/* 乘方是右结合的，并且比负号优先，-2 ** 2等于-4 */
+%right POW
 
 %%
 
@@ -52,98 +73,194 @@ statements
 			l.statements = $$
 		}
 	}
-	| statement statements
+	| statements statement
 	{
-		$$ = append([]Statement{$1}, $2...)
-		if l, isLexerWrapper := yylex.(*LexerWrapper); isLexerWrapper {
+		$$ = $1
+		l, isLexerWrapper := yylex.(*LexerWrapper)
+		if isLexerWrapper {
+			if !l.dropStatement($2) {
+				$$ = append($$, $2)
+			}
 			l.statements = $$
+		} else if $2 != nil {
+			$$ = append($$, $2)
 		}
 	}
 
 statement
 	: expr ';'
 	{
-		$$ = &ExpressionStatement{Expr: $1}
+		$$ = &ExpressionStatement{Span: spanOf($1.Pos(), $<tok>2.end), Expr: $1}
 	}
 	| VAR IDENT '=' expr ';'
 	{
-		$$ = &VarDefStatement{VarName: $2.lit, Expr: $4}
+		$$ = &VarDefStatement{Span: spanOf($1.pos, $<tok>5.end), VarName: $2.lit, Expr: $4}
 	}
-
-expr	: NUMBER
+	/* 出错后跳过直到下一个分号，继续解析后面的语句 */
+	| error ';'
 	{
-		$$ = &NumberExpression{Val: $1.val}
+		$$ = nil
 	}
+
+expr	: literal
 	| IDENT
 	{
-		$$ = &IdentifierExpression{Lit: $1.lit}
+		$$ = &IdentifierExpression{Span: $1.span(), Lit: $1.lit}
+	}
+	| IDENT '(' ')'
+	{
+		$$ = &CallExpression{Span: spanOf($1.pos, $<tok>3.end), Name: $1.lit}
+	}
+	| IDENT '(' arguments ')'
+	{
+		$$ = &CallExpression{Span: spanOf($1.pos, $<tok>4.end), Name: $1.lit, Args: $3}
 	}
 	| expr '?' expr ':' expr
 	{
-		$$ = &TernaryExpression{Cond: $1, TrueExpr: $3, FalseExpr: $5}
+		$$ = &TernaryExpression{Span: spanOf($1.Pos(), $5.End()), Cond: $1, TrueExpr: $3, FalseExpr: $5}
+	}
+	| array
+	{
+		$$ = $1
+	}
+	| expr IN expr
+	{
+		$$ = newIn(spanOf($1.Pos(), $3.End()), $1, $3, false)
 	}
-	| expr IN array
+	| expr NOT IN expr      %prec IN
 	{
-		$$ = &InExpression{LHS: $1, Arr: $3}
+		$$ = newIn(spanOf($1.Pos(), $4.End()), $1, $4, true)
 	}
 	| '!' expr      %prec UNARY
 	{
-		$$ = &UnaryNotExpression{SubExpr: $2}
+		$$ = &UnaryNotExpression{Span: spanOf($<tok>1.pos, $2.End()), SubExpr: $2}
 	}
 	| '-' expr      %prec UNARY
 	{
-		$$ = &UnaryMinusExpression{SubExpr: $2}
+		$$ = &UnaryMinusExpression{Span: spanOf($<tok>1.pos, $2.End()), SubExpr: $2}
+	}
+	| '~' expr      %prec UNARY
+	{
+		$$ = &UnaryBitNotExpression{Span: spanOf($<tok>1.pos, $2.End()), SubExpr: $2}
 	}
 	| '(' expr ')'
 	{
-		$$ = &ParenExpression{SubExpr: $2}
+		$$ = &ParenExpression{Span: spanOf($<tok>1.pos, $<tok>3.end), SubExpr: $2}
 	}
 	| expr LAND expr
-	{ $$ = &BinOpLogicExpression{LHS: $1, Operator: LAND, RHS: $3} }
+	{ $$ = &BinOpLogicExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: LAND, RHS: $3} }
 	| expr LOR expr
-	{ $$ = &BinOpLogicExpression{LHS: $1, Operator: LOR, RHS: $3} }
+	{ $$ = &BinOpLogicExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: LOR, RHS: $3} }
 	| expr EQ expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: EQ, RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: EQ, RHS: $3} }
 	| expr NE expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: NE, RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: NE, RHS: $3} }
 	| expr LE expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: LE, RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: LE, RHS: $3} }
 	| expr LT expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: LT, RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: LT, RHS: $3} }
 	| expr GE expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: GE, RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: GE, RHS: $3} }
 	| expr GT expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: GT, RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: GT, RHS: $3} }
 	| expr '+' expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: int('+'), RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: int('+'), RHS: $3} }
 	| expr '-' expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: int('-'), RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: int('-'), RHS: $3} }
 	| expr '*' expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: int('*'), RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: int('*'), RHS: $3} }
 	| expr '/' expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: int('/'), RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: int('/'), RHS: $3} }
 	| expr '%' expr
-	{ $$ = &BinOpExpression{LHS: $1, Operator: int('%'), RHS: $3} }
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: int('%'), RHS: $3} }
+	| expr '&' expr
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: int('&'), RHS: $3} }
+	| expr '|' expr
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: int('|'), RHS: $3} }
+	| expr '^' expr
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: int('^'), RHS: $3} }
+	| expr POW expr
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: POW, RHS: $3} }
+	| expr SHL expr
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: SHL, RHS: $3} }
+	| expr SHR expr
+	{ $$ = &BinOpExpression{Span: spanOf($1.Pos(), $3.End()), LHS: $1, Operator: SHR, RHS: $3} }
 
 array
 	: '[' array_element ']'
 	{
-		$$ = $2
+		$$ = &ArrayExpression{Span: spanOf($<tok>1.pos, $<tok>3.end), Arr: $2}
 	}
 	|
 	'[' ']'
 	{
-
+		$$ = &ArrayExpression{Span: spanOf($<tok>1.pos, $<tok>2.end)}
 	}
 
 array_element
+	: element
+	{
+		$$ = []Expression{$1}
+	}
+	| array_element ',' element
+	{
+		$$ = append($1, $3)
+	}
+
+element
+	: expr
+	/* 整数区间，包含两端 */
+	| range_bound DOTDOT range_bound
+	{
+		if $1.val > $3.val {
+			if l, isLexerWrapper := yylex.(*LexerWrapper); isLexerWrapper {
+				l.errs = append(l.errs, newParseError($1.pos, $1.lit+".."+$3.lit, "invalid range: lower bound is greater than upper bound"))
+			}
+		}
+		$$ = &RangeExpression{Span: spanOf($1.pos, $3.end), Low: $1.val, High: $3.val}
+	}
+
+/* 整数区间的上下界，可以带负号 */
+range_bound
+	: NUMBER
+	| '-' NUMBER
+	{
+		$$ = $2
+		$$.val = -$2.val
+		$$.lit = "-" + $2.lit
+		$$.pos = $<tok>1.pos
+	}
+
+arguments
+	: expr
+	{
+		$$ = []Expression{$1}
+	}
+	| arguments ',' expr
+	{
+		$$ = append($1, $3)
+	}
+
+literal
 	: NUMBER
 	{
-		$$ = []NumberExpression{NumberExpression{Val: $1.val}}
+		$$ = &NumberExpression{Span: $1.span(), Val: $1.val}
 	}
-	| array_element ',' NUMBER
+	| FLOAT
 	{
-		$$ = append($1, NumberExpression{Val: $3.val})
+		$$ = &FloatExpression{Span: $1.span(), Val: $1.fval}
+	}
+	| STRING
+	{
+		$$ = &StringExpression{Span: $1.span(), Val: $1.sval}
+	}
+	| TRUE
+	{
+		$$ = &BoolExpression{Span: $1.span(), Val: true}
+	}
+	| FALSE
+	{
+		$$ = &BoolExpression{Span: $1.span(), Val: false}
 	}
 
 %%
@@ -153,33 +270,97 @@ type LexerWrapper struct {
 	recentLit  string
 	recentPos  Position
 	statements []Statement
+	errs       ParseErrorList
+	checked    int // 已经检查过属于哪条语句的错误个数
+}
+
+/**
+ * @description: 字面量不合法时语句仍然会被归约，但是不算解析成功.
+ * 检查上一条语句之后记录的、位于这条语句中的错误
+ * @param {Statement} stmt 出错后恢复的语句为nil
+ * @return {*} 语句是否应该被丢弃
+ */
+func (l *LexerWrapper) dropStatement(stmt Statement) bool {
+	if stmt == nil {
+		l.checked = len(l.errs)
+		return true
+	}
+	drop := false
+	for ; l.checked < len(l.errs) && l.errs[l.checked].Position.before(stmt.End()); l.checked++ {
+		drop = true
+	}
+	return drop
+}
+
+func init() {
+	// 需要goyacc给出期望的token列表
+	yyErrorVerbose = true
 }
 
 func (l *LexerWrapper) Lex(lval *yySymType) int {
 	tok, lit, pos := l.s.Scan()
+	l.recentLit = lit
+	l.recentPos = pos
 	if tok == EOF {
 		return 0
 	}
-	lval.tok = Token{tok: tok, lit: lit, pos: pos}
-	if tok == NUMBER {
-		lval.tok.val, _ = toNumber(lit)
+	// Scan结束时扫描器恰好停在token末尾
+	lval.tok = Token{tok: tok, lit: lit, pos: pos, end: l.s.position()}
+	var err error
+	switch tok {
+	case NUMBER:
+		lval.tok.val, err = toNumber(lit)
+	case FLOAT:
+		lval.tok.fval, err = toFloat(lit)
+	case STRING:
+		lval.tok.sval, err = toString(lit)
+	}
+	if err != nil {
+		l.errs = append(l.errs, newParseError(pos, lit, err.Error()))
 	}
-	l.recentLit = lit
-	l.recentPos = pos
 	return tok
 }
 
 func (l *LexerWrapper) Error(e string) {
-	err := __yyfmt__.Sprintf("Line %d, Column %d: %q %s",
-		l.recentPos.Line, l.recentPos.Column, l.recentLit, e)
-	log.Print(err)
-	panic(err)
+	l.errs = append(l.errs, newParseError(l.recentPos, l.recentLit, e))
 }
 
-func Parse(s *Scanner) []Statement {
+/**
+ * @description: 解析脚本，遇到语法错误时会跳过出错的语句继续解析，
+ * 返回所有解析成功的语句以及所有的语法错误
+ * @param {*Scanner} s
+ * @return {*}
+ */
+func ParseAll(s *Scanner) ([]Statement, ParseErrorList) {
 	l := LexerWrapper{s: s}
-	if yyParse(&l) != 0 {
-		panic("Parse error")
+	if yyParse(&l) != 0 && len(l.errs) == 0 {
+		l.errs = append(l.errs, newParseError(l.recentPos, l.recentLit, "syntax error"))
+	}
+	return l.statements, l.errs
+}
+
+/**
+ * @description: 解析脚本，遇到语法错误时返回第一个*ParseError
+ * @param {*Scanner} s
+ * @return {*}
+ */
+func ParseE(s *Scanner) ([]Statement, error) {
+	statements, errs := ParseAll(s)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return statements, nil
+}
+
+/**
+ * @description: 解析脚本，遇到语法错误时panic，错误值为*ParseError
+ * @param {*Scanner} s
+ * @return {*}
+ */
+func Parse(s *Scanner) []Statement {
+	statements, err := ParseE(s)
+	if err != nil {
+		panic(err)
 	}
-	return l.statements
+	return statements
 }
@@ -0,0 +1,118 @@
+package calc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+/**
+ * @description: 编译后的脚本，只解析和检查一次，可以反复求值.
+ * Run不会修改传入的Env，可以在多个goroutine中同时调用
+ */
+type Program struct {
+	eva        Evaluator
+	statements []Statement
+	code       []*bytecode // 使用BackendVM时预先编译的字节码
+	tree       []Statement // 使用BackendTree时变量已经解析为槽位的语句
+	maxStack   int         // 所有字节码需要的最大栈深度
+	slots      *slotTable
+	structs    sync.Map // BindStruct缓存的结构体字段，reflect.Type -> []int
+}
+
+/**
+ * @description: 使用默认的求值器编译脚本
+ * @param {string} src
+ * @return {*}
+ */
+func Compile(src string) (*Program, error) {
+	return NewEvaluator().Compile(src)
+}
+
+/**
+ * @description: 解析并检查脚本，返回的Program使用求值器当前的设置，
+ * 之后对求值器的修改(包括注册新的函数)不会影响已经编译的Program
+ * @param {string} src
+ * @return {*}
+ */
+func (e Evaluator) Compile(src string) (*Program, error) {
+	scanner := new(Scanner)
+	scanner.Init(src)
+	statements, err := ParseE(scanner)
+	if err != nil {
+		return nil, err
+	}
+	if err = e.Check(statements); err != nil {
+		return nil, err
+	}
+	if e.funcs != nil {
+		funcs := make(map[string]*Func, len(e.funcs))
+		for name, fn := range e.funcs {
+			funcs[name] = fn
+		}
+		e.funcs = funcs
+	}
+	p := &Program{eva: e, statements: statements, slots: newSlotTable(statements)}
+	if e.backend == BackendVM {
+		p.code = make([]*bytecode, len(statements))
+		for i, s := range statements {
+			if p.code[i], err = e.compile(s, p.slots); err != nil {
+				return nil, err
+			}
+			if p.code[i].maxStack > p.maxStack {
+				p.maxStack = p.code[i].maxStack
+			}
+		}
+	} else {
+		p.tree = p.slots.resolve(statements)
+	}
+	return p, nil
+}
+
+// Statements 返回编译后的语句，调用者不应该修改
+func (p *Program) Statements() []Statement {
+	return p.statements
+}
+
+/**
+ * @description: 求值并返回最后一条语句的值，var定义的变量以及条件的结果只在本次求值中有效
+ * @param {Env} env 只读，可以被多个goroutine共享
+ * @return {*}
+ */
+func (p *Program) Run(env Env) (Value, error) {
+	return p.RunContext(context.Background(), env)
+}
+
+/**
+ * @description: 与Run相同，ctx被取消或者超时后停止求值并返回ctx.Err()
+ * @param {context.Context} ctx
+ * @param {Env} env
+ * @return {*}
+ */
+func (p *Program) RunContext(ctx context.Context, env Env) (Value, error) {
+	return p.RunFrame(ctx, p.Bind(env))
+}
+
+/**
+ * @description: 使用已经绑定好的变量求值，求值过程中var定义的变量以及条件的结果会保存到f中
+ * @param {context.Context} ctx
+ * @param {*Frame} f 由这个Program的Bind或BindStruct创建
+ * @return {*}
+ */
+func (p *Program) RunFrame(ctx context.Context, f *Frame) (v Value, err error) {
+	if f.slots != p.slots {
+		return Value{}, fmt.Errorf("frame was not bound by this program")
+	}
+	for i := range p.statements {
+		if p.code != nil {
+			v, err = p.eva.run(ctx, p.code[i], f, f.stack)
+		} else {
+			v, err = p.eva.evaluateStmt(ctx, p.tree[i], f)
+		}
+		if err != nil {
+			err = fmt.Errorf("evaluator failed to eval: %w", err)
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,163 @@
+package calc
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ErrInvalidNode 语法树不合法，通常是手工构造的节点缺少子节点或者使用了未知的运算符
+var ErrInvalidNode = errors.New("invalid node")
+
+/**
+ * @description: 检查语法树是否合法：节点不能为nil，运算符必须是已知的运算符，
+ * 整数区间只能出现在数组中并且下界不能大于上界等.解析器生成的语法树总是合法的，
+ * 手工构造的语法树在求值之前会被检查，错误为*EvalError，可以用errors.Is(err, ErrInvalidNode)判断
+ * @param {[]Statement} statements
+ * @return {*}
+ */
+func Validate(statements []Statement) error {
+	for _, stmt := range statements {
+		if err := validateStmt(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateStmt(statement Statement) error {
+	if isNilNode(statement) {
+		return errorAt(nil, "%w: nil statement", ErrInvalidNode)
+	}
+	switch s := statement.(type) {
+	case *ExpressionStatement:
+		return validateExpr(s, s.Expr)
+	case *VarDefStatement:
+		if s.VarName == "" {
+			return errorAt(s, "%w: var without a name", ErrInvalidNode)
+		}
+		return validateExpr(s, s.Expr)
+	}
+	return errorAt(statement, "%w: unknown statement type %T", ErrInvalidNode, statement)
+}
+
+/**
+ * @description: 检查表达式及其子节点
+ * @param {Node} parent 表达式为nil时在父节点的位置报告错误
+ * @param {Expression} expr
+ * @return {*}
+ */
+func validateExpr(parent Node, expr Expression) error {
+	if isNilNode(expr) {
+		return errorAt(parent, "%w: missing expression", ErrInvalidNode)
+	}
+	switch e := expr.(type) {
+	case *NumberExpression, *FloatExpression, *StringExpression, *BoolExpression:
+		return nil
+	case *IdentifierExpression:
+		if e.Lit == "" {
+			return errorAt(e, "%w: empty identifier", ErrInvalidNode)
+		}
+		return nil
+	case *CallExpression:
+		if e.Name == "" {
+			return errorAt(e, "%w: call without a function name", ErrInvalidNode)
+		}
+		return validateExprs(e, e.Args)
+	case *ArrayExpression:
+		return validateElements(e, e.Arr)
+	case *UnaryMinusExpression:
+		return validateExpr(e, e.SubExpr)
+	case *UnaryBitNotExpression:
+		return validateExpr(e, e.SubExpr)
+	case *UnaryNotExpression:
+		return validateExpr(e, e.SubExpr)
+	case *ParenExpression:
+		return validateExpr(e, e.SubExpr)
+	case *BinOpExpression:
+		switch e.Operator {
+		case EQ, NE, GE, GT, LE, LT, '+', '-', '*', '/', '%', POW, '&', '|', '^', SHL, SHR:
+		default:
+			return errorAt(e, "%w: unknown operator %s", ErrInvalidNode, operatorName(e.Operator))
+		}
+		if err := validateExpr(e, e.LHS); err != nil {
+			return err
+		}
+		return validateExpr(e, e.RHS)
+	case *BinOpLogicExpression:
+		if e.Operator != LAND && e.Operator != LOR {
+			return errorAt(e, "%w: unknown logical operator %s", ErrInvalidNode, operatorName(e.Operator))
+		}
+		if err := validateExpr(e, e.LHS); err != nil {
+			return err
+		}
+		return validateExpr(e, e.RHS)
+	case *InExpression:
+		if err := validateExpr(e, e.LHS); err != nil {
+			return err
+		}
+		if e.RHS == nil {
+			return validateElements(e, e.Arr)
+		}
+		if len(e.Arr) > 0 {
+			return errorAt(e, "%w: in has both an array literal and an array expression", ErrInvalidNode)
+		}
+		return validateExpr(e, e.RHS)
+	case *InSetExpression:
+		if err := validateExpr(e, e.LHS); err != nil {
+			return err
+		}
+		for _, ele := range e.Arr {
+			if _, ok := elementValue(ele); !ok {
+				if _, ok := ele.(*RangeExpression); !ok {
+					return errorAt(e, "%w: InSetExpression can only contain literals and ranges", ErrInvalidNode)
+				}
+			}
+		}
+		return validateElements(e, e.Arr)
+	case *RangeExpression:
+		return errorAt(e, "%w: range can only be used in an array", ErrInvalidNode)
+	case *TernaryExpression:
+		for _, sub := range []Expression{e.Cond, e.TrueExpr, e.FalseExpr} {
+			if err := validateExpr(e, sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errorAt(parent, "%w: unknown expression type %T", ErrInvalidNode, expr)
+}
+
+func validateExprs(parent Node, list []Expression) error {
+	for _, x := range list {
+		if err := validateExpr(parent, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 数组中的元素，只有这里可以出现整数区间
+func validateElements(parent Node, arr []Expression) error {
+	for _, ele := range arr {
+		r, ok := ele.(*RangeExpression)
+		if !ok || r == nil {
+			if err := validateExpr(parent, ele); err != nil {
+				return err
+			}
+			continue
+		}
+		if r.Low > r.High {
+			return errorAt(r, "%w: invalid range %d..%d", ErrInvalidNode, r.Low, r.High)
+		}
+	}
+	return nil
+}
+
+// 节点为nil或者为nil指针，例如(*NumberExpression)(nil)
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
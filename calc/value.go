@@ -0,0 +1,504 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	KindInvalid Kind = iota
+	KindInt
+	KindFloat
+	KindString
+	KindBool
+	// KindAny 只用于声明函数参数，表示接受任意类型
+	KindAny
+	KindArray
+)
+
+var kindNames = [...]string{
+	KindInvalid: "invalid",
+	KindInt:     "int",
+	KindFloat:   "float",
+	KindString:  "string",
+	KindBool:    "bool",
+	KindAny:     "any",
+	KindArray:   "array",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "kind-" + strconv.Itoa(int(k))
+}
+
+/**
+ * @description: 表达式求值的结果，整数和浮点数参与运算时整数会被提升为浮点数
+ */
+type Value struct {
+	kind Kind
+	i    int // 整数的值，布尔值用0和1表示
+	f    float64
+	s    string
+	arr  *[]Value // 数组的元素，使用指针使Value仍然可以比较
+}
+
+func IntValue(n int) Value {
+	return Value{kind: KindInt, i: n}
+}
+
+func FloatValue(f float64) Value {
+	return Value{kind: KindFloat, f: f}
+}
+
+func StringValue(s string) Value {
+	return Value{kind: KindString, s: s}
+}
+
+func BoolValue(b bool) Value {
+	return Value{kind: KindBool, i: boolToInt(b)}
+}
+
+func ArrayValue(elems []Value) Value {
+	return Value{kind: KindArray, arr: &elems}
+}
+
+/**
+ * @description: 将Env中的Go值转换为Value，支持各种整数、浮点数类型以及字符串和布尔值，
+ * 切片和数组转换为数组，其中的元素也必须是支持的类型
+ * @param {interface{}} x
+ * @return {*}
+ */
+func ValueOf(x interface{}) (Value, error) {
+	switch v := x.(type) {
+	case Value:
+		return v, nil
+	case int:
+		return IntValue(v), nil
+	case int8:
+		return IntValue(int(v)), nil
+	case int16:
+		return IntValue(int(v)), nil
+	case int32:
+		return IntValue(int(v)), nil
+	case int64:
+		return IntValue(int(v)), nil
+	case uint:
+		return IntValue(int(v)), nil
+	case uint8:
+		return IntValue(int(v)), nil
+	case uint16:
+		return IntValue(int(v)), nil
+	case uint32:
+		return IntValue(int(v)), nil
+	case uint64:
+		return IntValue(int(v)), nil
+	case float32:
+		return FloatValue(float64(v)), nil
+	case float64:
+		return FloatValue(v), nil
+	case string:
+		return StringValue(v), nil
+	case bool:
+		return BoolValue(v), nil
+	case []Value:
+		return ArrayValue(v), nil
+	}
+	rv := reflect.ValueOf(x)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		elems := make([]Value, rv.Len())
+		for i := range elems {
+			elem, err := ValueOf(rv.Index(i).Interface())
+			if err != nil {
+				return Value{}, err
+			}
+			elems[i] = elem
+		}
+		return ArrayValue(elems), nil
+	}
+	return Value{}, fmt.Errorf("unsupported value type %T", x)
+}
+
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+// Int 浮点数会被截断为整数，布尔值返回0或1，字符串和数组返回0
+func (v Value) Int() int {
+	if v.kind == KindFloat {
+		return int(v.f)
+	}
+	return v.i
+}
+
+func (v Value) Float() float64 {
+	if v.kind == KindFloat {
+		return v.f
+	}
+	return float64(v.i)
+}
+
+// Bool 非零数字以及非空字符串和数组为true
+func (v Value) Bool() bool {
+	return v.isTrue()
+}
+
+// Str 返回字符串的值，非字符串返回空串
+func (v Value) Str() string {
+	if v.kind == KindString {
+		return v.s
+	}
+	return ""
+}
+
+// Array 返回数组的元素，非数组返回nil，调用者不应该修改
+func (v Value) Array() []Value {
+	if v.kind == KindArray {
+		return *v.arr
+	}
+	return nil
+}
+
+// Interface 转换为可以放入Env的Go值
+func (v Value) Interface() interface{} {
+	switch v.kind {
+	case KindFloat:
+		return v.f
+	case KindString:
+		return v.s
+	case KindBool:
+		return v.i != 0
+	case KindArray:
+		elems := make([]interface{}, len(*v.arr))
+		for i, elem := range *v.arr {
+			elems[i] = elem.Interface()
+		}
+		return elems
+	}
+	return v.i
+}
+
+func (v Value) String() string {
+	switch v.kind {
+	case KindFloat:
+		return strconv.FormatFloat(v.f, 'g', -1, 64)
+	case KindString:
+		return v.s
+	case KindBool:
+		return strconv.FormatBool(v.i != 0)
+	case KindArray:
+		elems := make([]string, len(*v.arr))
+		for i, elem := range *v.arr {
+			elems[i] = elem.String()
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	return strconv.Itoa(v.i)
+}
+
+// 非零数字以及非空字符串和数组为真
+func (v Value) isTrue() bool {
+	switch v.kind {
+	case KindFloat:
+		return v.f != 0
+	case KindString:
+		return v.s != ""
+	case KindArray:
+		return len(*v.arr) > 0
+	}
+	return v.i != 0
+}
+
+func (v Value) isNumber() bool {
+	return v.kind == KindInt || v.kind == KindFloat
+}
+
+// 非严格模式下布尔值按0和1参与运算
+func (v Value) promoteBool() Value {
+	if v.kind == KindBool {
+		return IntValue(v.i)
+	}
+	return v
+}
+
+// ========================================
+
+func negate(v Value) (Value, error) {
+	switch v.kind {
+	case KindInt:
+		return IntValue(-v.i), nil
+	case KindFloat:
+		return FloatValue(-v.f), nil
+	}
+	return Value{}, &TypeError{Msg: fmt.Sprintf("invalid operation: -%s", v.kind)}
+}
+
+// complement 按位取反，只能用于整数
+func complement(v Value) (Value, error) {
+	if v.kind != KindInt {
+		return Value{}, &TypeError{Msg: fmt.Sprintf("invalid operation: ~%s", v.kind)}
+	}
+	return IntValue(^v.i), nil
+}
+
+func operatorName(op int) string {
+	switch op {
+	case EQ:
+		return "=="
+	case NE:
+		return "!="
+	case GE:
+		return ">="
+	case GT:
+		return ">"
+	case LE:
+		return "<="
+	case LT:
+		return "<"
+	case LAND:
+		return "&&"
+	case LOR:
+		return "||"
+	case SHL:
+		return "<<"
+	case SHR:
+		return ">>"
+	case POW:
+		return "**"
+	}
+	// 手工构造的语法树中可能出现任意的运算符，不是可打印的ASCII字符时显示数值
+	if op > ' ' && op < 0x7f {
+		return string(rune(op))
+	}
+	return strconv.Itoa(op)
+}
+
+func mismatched(op int, lhs, rhs Value) error {
+	return &TypeError{Msg: fmt.Sprintf("invalid operation: mismatched types %s and %s for %s", lhs.kind, rhs.kind, operatorName(op))}
+}
+
+/**
+ * @description: 比较运算，字符串按字典序比较，数字有一边是浮点数时按浮点数比较，
+ * 布尔值只能判断是否相等
+ * @param {int} op
+ * @param {Value} lhs
+ * @param {Value} rhs
+ * @return {*}
+ */
+func compare(op int, lhs, rhs Value) (Value, error) {
+	var c int
+	switch {
+	case lhs.kind == KindString && rhs.kind == KindString:
+		c = strings.Compare(lhs.s, rhs.s)
+	case lhs.kind == KindBool && rhs.kind == KindBool && (op == EQ || op == NE):
+		c = compareInt(lhs.i, rhs.i)
+	case lhs.kind == KindInt && rhs.kind == KindInt:
+		c = compareInt(lhs.i, rhs.i)
+	case lhs.isNumber() && rhs.isNumber():
+		l, r := lhs.Float(), rhs.Float()
+		if l != l || r != r {
+			// NaN与任何值都不相等
+			return BoolValue(op == NE), nil
+		}
+		c = compareFloat(l, r)
+	default:
+		return Value{}, mismatched(op, lhs, rhs)
+	}
+	switch op {
+	case EQ:
+		return BoolValue(c == 0), nil
+	case NE:
+		return BoolValue(c != 0), nil
+	case GE:
+		return BoolValue(c >= 0), nil
+	case GT:
+		return BoolValue(c > 0), nil
+	case LE:
+		return BoolValue(c <= 0), nil
+	case LT:
+		return BoolValue(c < 0), nil
+	}
+	return Value{}, fmt.Errorf("unknown operator %s", operatorName(op))
+}
+
+func compareInt(l, r int) int {
+	if l < r {
+		return -1
+	} else if l > r {
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(l, r float64) int {
+	if l < r {
+		return -1
+	} else if l > r {
+		return 1
+	}
+	return 0
+}
+
+/**
+ * @description: 四则运算，两边都是整数时结果为整数，否则结果为浮点数.
+ * 字符串只支持+，用于拼接两个字符串
+ * @param {int} op
+ * @param {Value} lhs
+ * @param {Value} rhs
+ * @return {*}
+ */
+func arith(op int, lhs, rhs Value) (Value, error) {
+	if lhs.kind == KindString && rhs.kind == KindString && op == '+' {
+		return StringValue(lhs.s + rhs.s), nil
+	}
+	if !lhs.isNumber() || !rhs.isNumber() {
+		return Value{}, mismatched(op, lhs, rhs)
+	}
+	// 整数的负数次幂按浮点数计算
+	if lhs.kind == KindInt && rhs.kind == KindInt && !(op == POW && rhs.i < 0) {
+		l, r := lhs.i, rhs.i
+		switch op {
+		case POW:
+			return intPow(l, r)
+		case '+':
+			return IntValue(l + r), nil
+		case '-':
+			return IntValue(l - r), nil
+		case '*':
+			return IntValue(l * r), nil
+		case '/':
+			if r == 0 {
+				return Value{}, ErrDivisionByZero
+			}
+			return IntValue(l / r), nil
+		case '%':
+			if r == 0 {
+				return Value{}, ErrDivisionByZero
+			}
+			return IntValue(l % r), nil
+		}
+		return Value{}, fmt.Errorf("unknown operator %s", operatorName(op))
+	}
+	l, r := lhs.Float(), rhs.Float()
+	switch op {
+	case '+':
+		return FloatValue(l + r), nil
+	case '-':
+		return FloatValue(l - r), nil
+	case '*':
+		return FloatValue(l * r), nil
+	case '/':
+		return FloatValue(l / r), nil
+	case '%':
+		return FloatValue(math.Mod(l, r)), nil
+	case POW:
+		return FloatValue(math.Pow(l, r)), nil
+	}
+	return Value{}, fmt.Errorf("unknown operator %s", operatorName(op))
+}
+
+/**
+ * @description: 位运算和移位运算，两边都必须是整数，移位的位数不能为负数.
+ * 移位的位数不小于64时左移结果为0，右移结果为0或-1
+ * @param {int} op
+ * @param {Value} lhs
+ * @param {Value} rhs
+ * @return {*}
+ */
+func bitwise(op int, lhs, rhs Value) (Value, error) {
+	if lhs.kind != KindInt || rhs.kind != KindInt {
+		return Value{}, &TypeError{Msg: fmt.Sprintf("invalid operation: operator %s not defined on %s and %s", operatorName(op), lhs.kind, rhs.kind)}
+	}
+	l, r := lhs.i, rhs.i
+	switch op {
+	case '&':
+		return IntValue(l & r), nil
+	case '|':
+		return IntValue(l | r), nil
+	case '^':
+		return IntValue(l ^ r), nil
+	}
+	if r < 0 {
+		return Value{}, fmt.Errorf("invalid operation: negative shift count %d", r)
+	}
+	switch op {
+	case SHL:
+		return IntValue(l << uint(r)), nil
+	case SHR:
+		return IntValue(l >> uint(r)), nil
+	}
+	return Value{}, fmt.Errorf("unknown operator %s", operatorName(op))
+}
+
+const minInt = -1 << (strconv.IntSize - 1)
+
+// mulInt 整数乘法，溢出时ok为false
+func mulInt(a, b int) (ret int, ok bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	if a == -1 && b == minInt || b == -1 && a == minInt {
+		return 0, false
+	}
+	ret = a * b
+	return ret, ret/b == a
+}
+
+// intPow 整数乘方，exp不能为负数，结果溢出时返回错误
+func intPow(base, exp int) (Value, error) {
+	ret := 1
+	for e, b := exp, base; e > 0; e >>= 1 {
+		var ok bool
+		if e&1 == 1 {
+			if ret, ok = mulInt(ret, b); !ok {
+				return Value{}, fmt.Errorf("%w: %d ** %d", ErrIntegerOverflow, base, exp)
+			}
+		}
+		if e > 1 {
+			if b, ok = mulInt(b, b); !ok {
+				return Value{}, fmt.Errorf("%w: %d ** %d", ErrIntegerOverflow, base, exp)
+			}
+		}
+	}
+	return IntValue(ret), nil
+}
+
+/**
+ * @description: 与arith相同，但是两个整数的+ - * /溢出时返回ErrIntegerOverflow
+ * @param {int} op
+ * @param {Value} lhs
+ * @param {Value} rhs
+ * @return {*}
+ */
+func checkedArith(op int, lhs, rhs Value) (Value, error) {
+	if lhs.kind == KindInt && rhs.kind == KindInt {
+		l, r := lhs.i, rhs.i
+		ok := true
+		switch op {
+		case '+':
+			ok = (r >= 0) == (l+r >= l)
+		case '-':
+			ok = (r >= 0) == (l-r <= l)
+		case '*':
+			_, ok = mulInt(l, r)
+		case '/':
+			ok = l != minInt || r != -1
+		}
+		if !ok {
+			return Value{}, fmt.Errorf("%w: %d %s %d", ErrIntegerOverflow, l, operatorName(op), r)
+		}
+	}
+	return arith(op, lhs, rhs)
+}
+
+// equals 用于in运算，类型不同的值不相等
+func equals(lhs, rhs Value) bool {
+	v, err := compare(EQ, lhs, rhs)
+	return err == nil && v.isTrue()
+}
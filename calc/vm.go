@@ -0,0 +1,170 @@
+package calc
+
+import "context"
+
+// Backend 求值方式
+type Backend int
+
+const (
+	// BackendTree 直接遍历语法树求值
+	BackendTree Backend = iota
+	// BackendVM 先将语句编译为字节码，再由基于栈的虚拟机执行
+	BackendVM
+)
+
+// DefaultBackend NewEvaluator创建的求值器使用的求值方式
+var DefaultBackend = BackendTree
+
+/**
+ * @description: 设置求值方式，两种方式的求值结果和错误完全相同
+ * @param {Backend} backend
+ * @return {*}
+ */
+func (e *Evaluator) SetBackend(backend Backend) {
+	e.backend = backend
+}
+
+/**
+ * @description: 执行字节码，返回语句的值
+ * @param {context.Context} ctx
+ * @param {*bytecode} bc
+ * @param {variables} vars
+ * @param {[]Value} stack 复用的栈，容量不足时重新分配
+ * @return {*}
+ */
+func (eva Evaluator) run(ctx context.Context, bc *bytecode, vars variables, stack []Value) (Value, error) {
+	if cap(stack) < bc.maxStack {
+		stack = make([]Value, 0, bc.maxStack)
+	}
+	stack = stack[:0]
+	frame, _ := vars.(*Frame)
+	for pc := 0; pc < len(bc.code); pc++ {
+		if err := ctx.Err(); err != nil {
+			return Value{}, err
+		}
+		in, node := bc.code[pc], bc.nodes[pc]
+		top := len(stack) - 1
+		switch in.op {
+		case opConst:
+			stack = append(stack, bc.consts[in.arg])
+		case opLoad:
+			var v Value
+			var err error
+			if in.arg >= 0 {
+				v, err = eva.lookupSlot(ctx, node.(*IdentifierExpression), frame, in.arg)
+			} else {
+				v, err = eva.lookupVar(ctx, node.(*IdentifierExpression), vars)
+			}
+			if err != nil {
+				return Value{}, err
+			}
+			stack = append(stack, v)
+		case opUndefined:
+			return Value{}, errorAt(node, "undefined function: %s", node.(*CallExpression).Name)
+		case opCall:
+			e := node.(*CallExpression)
+			base := len(stack) - len(e.Args)
+			var fn *Func
+			if in.arg >= 0 {
+				fn = bc.funcs[in.arg]
+			}
+			// 参数直接使用栈上的值，不再复制
+			v, err := eva.invoke(ctx, e, fn, stack[base:])
+			if err != nil {
+				return Value{}, err
+			}
+			stack = append(stack[:base], v)
+		case opNeg:
+			v, err := eva.unaryMinus(node.(*UnaryMinusExpression), stack[top])
+			if err != nil {
+				return Value{}, err
+			}
+			stack[top] = v
+		case opBitNot:
+			v, err := eva.bitNot(node.(*UnaryBitNotExpression), stack[top])
+			if err != nil {
+				return Value{}, err
+			}
+			stack[top] = v
+		case opNot:
+			b, err := eva.condition(node.(Expression), stack[top])
+			if err != nil {
+				return Value{}, err
+			}
+			stack[top] = BoolValue(!b)
+		case opBinOp:
+			v, err := eva.binOp(node.(*BinOpExpression), stack[top-1], stack[top])
+			if err != nil {
+				return Value{}, err
+			}
+			stack = stack[:top]
+			stack[top-1] = v
+		case opBool:
+			b, err := eva.condition(node.(Expression), stack[top])
+			if err != nil {
+				return Value{}, err
+			}
+			stack[top] = BoolValue(b)
+		case opAnd, opOr:
+			b, err := eva.condition(node.(Expression), stack[top])
+			if err != nil {
+				return Value{}, err
+			}
+			if b == (in.op == opOr) {
+				stack[top] = BoolValue(b)
+				pc = in.arg - 1
+			} else {
+				stack = stack[:top]
+			}
+		case opJumpIfFalse:
+			b, err := eva.condition(node.(Expression), stack[top])
+			if err != nil {
+				return Value{}, err
+			}
+			stack = stack[:top]
+			if !b {
+				pc = in.arg - 1
+			}
+		case opJump:
+			pc = in.arg - 1
+		case opInTest:
+			found := eva.inEquals(stack[top-1], stack[top])
+			stack = stack[:top]
+			if found {
+				stack[top-1] = BoolValue(true)
+				pc = in.arg - 1
+			}
+		case opInFail:
+			stack[top] = BoolValue(false)
+		case opInRange:
+			if eva.inRange(stack[top], node.(*RangeExpression)) {
+				stack[top] = BoolValue(true)
+				pc = in.arg - 1
+			}
+		case opInSet:
+			stack[top] = BoolValue(eva.inSet(node.(*InSetExpression), stack[top]))
+		case opInArray:
+			found, err := eva.inArray(node.(*InExpression), stack[top-1], stack[top])
+			if err != nil {
+				return Value{}, err
+			}
+			stack = stack[:top]
+			stack[top-1] = BoolValue(found)
+		case opArray:
+			e := node.(*ArrayExpression)
+			base := len(stack) - len(e.Arr)
+			v, err := eva.newArray(e, stack[base:])
+			if err != nil {
+				return Value{}, err
+			}
+			stack = append(stack[:base], v)
+		case opDefine:
+			if in.arg >= 0 {
+				frame.set(in.arg, stack[top])
+			} else {
+				vars.define(node.(*VarDefStatement).VarName, stack[top])
+			}
+		}
+	}
+	return stack[len(stack)-1], nil
+}
@@ -0,0 +1,214 @@
+package calc
+
+/**
+ * @description: Walk遇到每个节点时调用Visit，返回的w不为nil时继续用w访问节点的子节点，
+ * 访问完子节点后再调用w.Visit(nil)，与go/ast相同
+ */
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+/**
+ * @description: 深度优先遍历语法树，先访问节点本身，再按源码中的顺序访问子节点.
+ * 数组中的元素(包括整数区间)也会被访问，为nil的子节点会被跳过
+ * @param {Visitor} v
+ * @param {Node} node
+ * @return {*}
+ */
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *ExpressionStatement:
+		walkExpr(v, n.Expr)
+	case *VarDefStatement:
+		walkExpr(v, n.Expr)
+	case *ArrayExpression:
+		walkExprs(v, n.Arr)
+	case *CallExpression:
+		walkExprs(v, n.Args)
+	case *UnaryMinusExpression:
+		walkExpr(v, n.SubExpr)
+	case *UnaryBitNotExpression:
+		walkExpr(v, n.SubExpr)
+	case *UnaryNotExpression:
+		walkExpr(v, n.SubExpr)
+	case *ParenExpression:
+		walkExpr(v, n.SubExpr)
+	case *BinOpExpression:
+		walkExpr(v, n.LHS)
+		walkExpr(v, n.RHS)
+	case *BinOpLogicExpression:
+		walkExpr(v, n.LHS)
+		walkExpr(v, n.RHS)
+	case *InExpression:
+		walkExpr(v, n.LHS)
+		walkExprs(v, n.Arr)
+		walkExpr(v, n.RHS)
+	case *InSetExpression:
+		walkExpr(v, n.LHS)
+		walkExprs(v, n.Arr)
+	case *TernaryExpression:
+		walkExpr(v, n.Cond)
+		walkExpr(v, n.TrueExpr)
+		walkExpr(v, n.FalseExpr)
+	}
+	v.Visit(nil)
+}
+
+func walkExpr(v Visitor, expr Expression) {
+	if !isNilNode(expr) {
+		Walk(v, expr)
+	}
+}
+
+func walkExprs(v Visitor, list []Expression) {
+	for _, x := range list {
+		walkExpr(v, x)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+/**
+ * @description: 用函数遍历语法树，f返回false时不再访问节点的子节点.
+ * 访问完子节点后会调用f(nil)
+ * @param {Node} node
+ * @param {func(Node) bool} f
+ * @return {*}
+ */
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+/**
+ * @description: 自底向上重写语句中的表达式，原来的语法树不会被修改
+ * @param {[]Statement} statements
+ * @param {func(Expression) Expression} f 见TransformExpr
+ * @return {*}
+ */
+func Transform(statements []Statement, f func(Expression) Expression) []Statement {
+	ret := make([]Statement, len(statements))
+	for i, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ExpressionStatement:
+			c := *s
+			c.Expr = TransformExpr(s.Expr, f)
+			ret[i] = &c
+		case *VarDefStatement:
+			c := *s
+			c.Expr = TransformExpr(s.Expr, f)
+			ret[i] = &c
+		default:
+			ret[i] = stmt
+		}
+	}
+	return ret
+}
+
+/**
+ * @description: 自底向上重写表达式：先重写子节点，再对复制出来的新节点调用f，用f的返回值替换这个节点，
+ * f返回nil时保留新节点.原来的语法树不会被修改，in后面的哈希表会按重写后的元素重新生成
+ * @param {Expression} expr
+ * @param {func(Expression) Expression} f
+ * @return {*}
+ */
+func TransformExpr(expr Expression, f func(Expression) Expression) Expression {
+	if isNilNode(expr) {
+		return expr
+	}
+	var ret Expression
+	switch e := expr.(type) {
+	case *NumberExpression:
+		c := *e
+		ret = &c
+	case *FloatExpression:
+		c := *e
+		ret = &c
+	case *StringExpression:
+		c := *e
+		ret = &c
+	case *BoolExpression:
+		c := *e
+		ret = &c
+	case *IdentifierExpression:
+		c := *e
+		ret = &c
+	case *RangeExpression:
+		c := *e
+		ret = &c
+	case *ArrayExpression:
+		c := *e
+		c.Arr = transformExprs(e.Arr, f)
+		ret = &c
+	case *CallExpression:
+		c := *e
+		c.Args = transformExprs(e.Args, f)
+		ret = &c
+	case *UnaryMinusExpression:
+		c := *e
+		c.SubExpr = TransformExpr(e.SubExpr, f)
+		ret = &c
+	case *UnaryBitNotExpression:
+		c := *e
+		c.SubExpr = TransformExpr(e.SubExpr, f)
+		ret = &c
+	case *UnaryNotExpression:
+		c := *e
+		c.SubExpr = TransformExpr(e.SubExpr, f)
+		ret = &c
+	case *ParenExpression:
+		c := *e
+		c.SubExpr = TransformExpr(e.SubExpr, f)
+		ret = &c
+	case *BinOpExpression:
+		c := *e
+		c.LHS, c.RHS = TransformExpr(e.LHS, f), TransformExpr(e.RHS, f)
+		ret = &c
+	case *BinOpLogicExpression:
+		c := *e
+		c.LHS, c.RHS = TransformExpr(e.LHS, f), TransformExpr(e.RHS, f)
+		ret = &c
+	case *InExpression:
+		c := *e
+		c.LHS, c.Arr, c.RHS = TransformExpr(e.LHS, f), transformExprs(e.Arr, f), TransformExpr(e.RHS, f)
+		ret = &c
+	case *InSetExpression:
+		lhs, arr := TransformExpr(e.LHS, f), transformExprs(e.Arr, f)
+		if set := literalSet(arr); set != nil {
+			ret = &InSetExpression{Span: e.Span, LHS: lhs, Arr: arr, Not: e.Not, set: set}
+		} else {
+			ret = &InExpression{Span: e.Span, LHS: lhs, Arr: arr, Not: e.Not}
+		}
+	case *TernaryExpression:
+		c := *e
+		c.Cond, c.TrueExpr, c.FalseExpr = TransformExpr(e.Cond, f), TransformExpr(e.TrueExpr, f), TransformExpr(e.FalseExpr, f)
+		ret = &c
+	default:
+		// 不认识的节点无法复制子节点，直接交给f
+		ret = expr
+	}
+	if x := f(ret); x != nil {
+		return x
+	}
+	return ret
+}
+
+func transformExprs(list []Expression, f func(Expression) Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+	ret := make([]Expression, len(list))
+	for i, x := range list {
+		ret[i] = TransformExpr(x, f)
+	}
+	return ret
+}
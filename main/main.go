@@ -17,7 +17,16 @@ func main() {
 		}
 		p := calc.NewParser()
 		evaluator := calc.NewEvaluator()
-		stmts := p.Parse(string(body))
+		stmts, errs := p.ParseAll(string(body))
+		if len(errs) > 0 {
+			for _, e := range errs {
+				log.Printf("%s: %s", arg, e)
+			}
+			os.Exit(1)
+		}
+		if err := evaluator.Check(stmts); err != nil {
+			log.Fatalf("%s: %s", arg, err)
+		}
 		for _, stmt := range stmts {
 			fmt.Println(evaluator.EvaluateStmt(stmt, env))
 		}
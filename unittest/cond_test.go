@@ -1,6 +1,10 @@
 package unittest
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/motto0808/go-calc/calc"
@@ -28,6 +32,21 @@ func (*CondHelper) Eval(name string, args interface{}) int {
 	return int(cond.Calc(args))
 }
 
+// 带参数的条件，例如itemCount(1001)
+func (*CondHelper) EvalParam(name string, params []calc.Value, args interface{}) (int, error) {
+	switch name {
+	case "itemCount":
+		if len(params) != 1 || params[0].Kind() != calc.KindInt {
+			return 0, fmt.Errorf("itemCount expects an item id")
+		}
+		bag := args.(map[int]int)
+		return bag[params[0].Int()], nil
+	case "questDone":
+		return len(params), nil
+	}
+	return 0, fmt.Errorf("unknown condition %s", name)
+}
+
 type ChargeCond struct {
 }
 type AgeCond struct {
@@ -54,3 +73,144 @@ func TestCondition(t *testing.T) {
 	assert(t, err == nil)
 	assert(t, v == 1)
 }
+
+func TestParamCondition(t *testing.T) {
+	eva := calc.NewEvaluator()
+	eva.SetCondHelper(&condHelper, map[int]int{1001: 6, 1002: 1})
+	v, err := eva.Eval("itemCount(1001) >= 5 && itemCount(1000 + 2) < 5 && charge >= 200", calc.Env{})
+	assert(t, err == nil && v == 1, fmt.Sprintf("unexpected result %v %v", v, err))
+	v, err = eva.Eval("questDone()", calc.Env{})
+	assert(t, err == nil && v == 0, fmt.Sprintf("unexpected result %v %v", v, err))
+	// 内置函数优先于条件
+	v, err = eva.Eval("max(itemCount(1002), 3)", calc.Env{})
+	assert(t, err == nil && v == 3, fmt.Sprintf("unexpected result %v %v", v, err))
+
+	_, err = eva.Eval("itemCount(\"sword\")", calc.Env{})
+	assert(t, err != nil && strings.Contains(err.Error(), "condition itemCount: itemCount expects an item id"), fmt.Sprintf("unexpected error %v", err))
+	_, err = eva.Eval("bossKilled(1)", calc.Env{})
+	assert(t, err != nil && strings.Contains(err.Error(), "unknown condition bossKilled"), fmt.Sprintf("unexpected error %v", err))
+
+	// 只处理带参数条件的辅助类
+	only := calc.NewEvaluator()
+	only.SetParamCondHelper(&condHelper, map[int]int{1001: 2})
+	v, err = only.Eval("itemCount(1001)", calc.Env{})
+	assert(t, err == nil && v == 2, fmt.Sprintf("unexpected result %v %v", v, err))
+	_, err = only.Eval("charge", calc.Env{})
+	assert(t, err != nil, "Expect plain conditions to need an ICondHelper")
+}
+
+type panicHelper struct{}
+
+func (panicHelper) Eval(name string, args interface{}) int {
+	panic("database is down")
+}
+
+var errDatabase = errors.New("database is down")
+
+type condHelperE struct{}
+
+func (condHelperE) Eval(name string, args interface{}) (int, error) {
+	switch name {
+	case "charge":
+		return 500, nil
+	case "vipLevel":
+		return 0, errDatabase
+	}
+	return 0, calc.ErrUndefinedCond
+}
+
+func TestConditionError(t *testing.T) {
+	// 条件辅助类panic时不再当作0处理
+	eva := calc.NewEvaluator()
+	eva.SetCondHelper(panicHelper{}, nil)
+	_, err := eva.Eval("var a = 1;\na + charge >= 200;", calc.Env{})
+	assert(t, err != nil && strings.Contains(err.Error(), "Line 2, Column 5: condition charge: panic: database is down"),
+		fmt.Sprintf("unexpected error %v", err))
+
+	eva = calc.NewEvaluator()
+	eva.SetCondHelperE(condHelperE{}, nil)
+	env := calc.Env{}
+	v, err := eva.Eval("charge >= 200", env)
+	assert(t, err == nil && v == 1, fmt.Sprintf("unexpected result %v %v", v, err))
+	assert(t, env["charge"] == 500, "Expect condition results to be cached in env")
+
+	_, err = eva.Eval("vipLevel > 3", env)
+	assert(t, errors.Is(err, errDatabase), fmt.Sprintf("Expect helper errors to be wrapped, but got %v", err))
+	assert(t, strings.Contains(err.Error(), "condition vipLevel"), fmt.Sprintf("Expect the error to name the condition, but got %v", err))
+
+	_, err = eva.Eval("unknown > 3", env)
+	assert(t, err != nil && strings.Contains(err.Error(), "undefined variable: unknown"), fmt.Sprintf("unexpected error %v", err))
+}
+
+// 返回任意类型的值的条件，例如玩家所在的服务器列表
+type condHelperValue struct{}
+
+func (condHelperValue) EvalValue(ctx context.Context, name string, args interface{}) (calc.Value, error) {
+	switch name {
+	case "allowedServers":
+		return calc.ValueOf(args)
+	case "broken":
+		return calc.Value{}, nil
+	}
+	return calc.Value{}, calc.ErrUndefinedCond
+}
+
+func (condHelperValue) EvalParamValue(ctx context.Context, name string, params []calc.Value, args interface{}) (calc.Value, error) {
+	if name == "serversOf" {
+		ids := make([]calc.Value, params[0].Int())
+		for i := range ids {
+			ids[i] = calc.IntValue(i + 1)
+		}
+		return calc.ArrayValue(ids), nil
+	}
+	return calc.Value{}, fmt.Errorf("unknown condition %s", name)
+}
+
+// 在旧的条件辅助类上增加返回数组的条件
+type serverCondHelper struct {
+	calc.ICondHelperValue
+}
+
+func (h serverCondHelper) EvalValue(ctx context.Context, name string, args interface{}) (calc.Value, error) {
+	if name == "allowedServers" {
+		return calc.ValueOf([]int{1, 3, 5})
+	}
+	return h.ICondHelperValue.EvalValue(ctx, name, args)
+}
+
+func TestAdaptCondHelper(t *testing.T) {
+	eva := calc.NewEvaluator()
+	eva.SetCondHelperValue(serverCondHelper{calc.AdaptCondHelper(&condHelper)}, map[int]int{1001: 6})
+	v, err := eva.Eval("serverId in allowedServers && charge >= 200 && itemCount(1001) >= 5", calc.Env{"serverId": 3})
+	assert(t, err == nil && v == 1, fmt.Sprintf("unexpected result %v %v", v, err))
+
+	// 任何调用都可能是带参数的条件，编译时不报告未定义的函数，求值时才返回错误
+	prog, err := eva.Compile("foo(1)")
+	assert(t, err == nil, fmt.Sprintf("Expect unknown calls to compile, but got %v", err))
+	_, err = prog.Run(calc.Env{})
+	assert(t, err != nil, "Expect unknown calls to fail at run time")
+
+	// 没有实现的条件按不存在处理
+	h := calc.AdaptCondHelper(condHelperE{})
+	_, err = h.EvalParamValue(context.Background(), "itemCount", nil, nil)
+	assert(t, errors.Is(err, calc.ErrUndefinedCond), fmt.Sprintf("unexpected error %v", err))
+	assert(t, calc.AdaptCondHelper(condHelperValue{}) == calc.ICondHelperValue(condHelperValue{}), "Expect ICondHelperValue to be returned as is")
+	assert(t, calc.AdaptCondHelper(nil) == nil, "Expect nil for a nil helper")
+
+	// 只实现了ICondHelperE的辅助类不能用于带参数的条件
+	eva.SetCondHelperE(condHelperE{}, nil)
+	_, err = eva.Eval("itemCount(1001)", calc.Env{})
+	assert(t, err != nil && strings.Contains(err.Error(), "undefined function: itemCount"), fmt.Sprintf("unexpected error %v", err))
+}
+
+func TestConditionValue(t *testing.T) {
+	eva := calc.NewEvaluator()
+	eva.SetCondHelperValue(condHelperValue{}, []int{1, 3, 5})
+	env := calc.Env{"serverId": 3}
+	v, err := eva.Eval("serverId in allowedServers && serverId in serversOf(3) && 4 not in allowedServers", env)
+	assert(t, err == nil && v == 1, fmt.Sprintf("unexpected result %v %v", v, err))
+	assert(t, fmt.Sprint(env["allowedServers"]) == "[1 3 5]", "Expect condition results to be cached in env")
+
+	_, err = eva.Eval("broken", env)
+	assert(t, err != nil && strings.Contains(err.Error(), "condition broken: invalid value"), fmt.Sprintf("unexpected error %v", err))
+}
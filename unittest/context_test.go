@@ -0,0 +1,66 @@
+package unittest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+type ctxKey struct{}
+
+// 从context中读取玩家数据，模拟需要查询数据库的条件
+type ctxCondHelper struct{}
+
+func (ctxCondHelper) EvalContext(ctx context.Context, name string, args interface{}) (int, error) {
+	if name == "slow" {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	player, _ := ctx.Value(ctxKey{}).(map[string]int)
+	if v, ok := player[name]; ok {
+		return v, nil
+	}
+	return 0, ErrUndefinedCond
+}
+
+func (ctxCondHelper) EvalParamContext(ctx context.Context, name string, params []Value, args interface{}) (int, error) {
+	player, _ := ctx.Value(ctxKey{}).(map[string]int)
+	return player[name] * params[0].Int(), nil
+}
+
+func TestEvalContext(t *testing.T) {
+	eva := NewEvaluator()
+	eva.SetCondHelperContext(ctxCondHelper{}, nil)
+	eva.RegisterFunc("bonus", &Func{
+		Params: []Kind{KindInt},
+		CallContext: func(ctx context.Context, args []Value) (Value, error) {
+			player, _ := ctx.Value(ctxKey{}).(map[string]int)
+			return IntValue(player["bonus"] + args[0].Int()), nil
+		},
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, map[string]int{"level": 30, "bonus": 5, "charge": 10})
+	v, err := eva.EvalContext(ctx, "level >= 30 && bonus(1) == 6 && charge(3) == 30", Env{})
+	assert(t, err == nil && v.Bool(), fmt.Sprintf("unexpected result %v %v", v, err))
+	_, err = eva.EvalContext(ctx, "vip", Env{})
+	assert(t, err != nil, "Expect undefined conditions to fail")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = eva.EvalContext(canceled, "1 + 1", Env{})
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprintf("Expect context.Canceled, but got %v", err))
+
+	stmts := NewParser().Parse("level + 1;")
+	_, err = eva.EvaluateStmtContext(canceled, stmts[0], Env{})
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprintf("Expect context.Canceled, but got %v", err))
+
+	// 条件辅助类阻塞时由deadline打断
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = eva.EvalContext(timeout, "slow > 0", Env{})
+	assert(t, errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("Expect context.DeadlineExceeded, but got %v", err))
+}
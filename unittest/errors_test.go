@@ -0,0 +1,108 @@
+package unittest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+func TestUndefinedVariableError(t *testing.T) {
+	evaluator := NewEvaluator()
+	_, err := evaluator.Eval("var a = 1;\na + missing;\n", Env{})
+	var undefined *UndefinedVariableError
+	if !errors.As(err, &undefined) {
+		t.Fatalf("Expect *UndefinedVariableError, but got %v", err)
+	}
+	assert(t, undefined.Name == "missing" && undefined.Node.Lit == "missing", fmt.Sprintf("unexpected error %+v", undefined))
+	assert(t, undefined.Line == 2 && undefined.Column == 5, fmt.Sprintf("unexpected position %v", undefined.Position))
+
+	var evalErr *EvalError
+	assert(t, errors.As(err, &evalErr) && evalErr.Node == Node(undefined.Node), "Expect the EvalError to wrap the typed error")
+	assert(t, strings.Contains(err.Error(), "Line 2, Column 5: undefined variable: missing"), fmt.Sprintf("unexpected message %v", err))
+
+	var typeErr *TypeError
+	assert(t, !errors.As(err, &typeErr), "Expect an undefined variable not to be a type error")
+}
+
+func TestDivisionByZeroError(t *testing.T) {
+	prog, err := Compile("a + b % (b - b)")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+	_, err = prog.Run(Env{"a": 1, "b": 2})
+	var div *DivisionByZeroError
+	if !errors.As(err, &div) {
+		t.Fatalf("Expect *DivisionByZeroError, but got %v", err)
+	}
+	assert(t, errors.Is(err, ErrDivisionByZero), "Expect errors.Is to match ErrDivisionByZero")
+	assert(t, div.Node.Operator == '%' && div.Line == 1 && div.Column == 5, fmt.Sprintf("unexpected error %+v", div))
+}
+
+func TestConditionErrorType(t *testing.T) {
+	eva := NewEvaluator()
+	eva.SetCondHelperE(condHelperE{}, nil)
+	_, err := eva.Eval("charge > 0 && vipLevel > 3", Env{})
+	var condErr *ConditionError
+	if !errors.As(err, &condErr) {
+		t.Fatalf("Expect *ConditionError, but got %v", err)
+	}
+	assert(t, condErr.Name == "vipLevel" && condErr.Column == 15, fmt.Sprintf("unexpected error %+v", condErr))
+	assert(t, errors.Is(err, errDatabase) && condErr.Err == errDatabase, "Expect the helper error to be wrapped")
+
+	eva.SetCondHelper(&condHelper, nil)
+	_, err = eva.Eval("itemCount(1001) > 0", Env{})
+	assert(t, errors.As(err, &condErr) && condErr.Name == "itemCount", fmt.Sprintf("unexpected error %v", err))
+	_, ok := condErr.Node.(*CallExpression)
+	assert(t, ok, "Expect parameterized conditions to report the call")
+}
+
+func TestTypeError(t *testing.T) {
+	evaluator := NewEvaluator()
+	evaluator.SetStrict(true)
+	tests := []struct {
+		src    string
+		column int
+		msg    string
+	}{
+		{src: "1 + \"a\"", column: 1, msg: "mismatched types int and string for +"},
+		{src: "1 + -\"a\"", column: 5, msg: "invalid operation: -string"},
+		{src: "1 + ~1.5", column: 5, msg: "invalid operation: ~float"},
+		{src: "1.5 | 1", column: 1, msg: "operator | not defined on float and int"},
+		{src: "true && 1", column: 9, msg: "non-boolean condition: int"},
+		{src: "1 in a", column: 6, msg: "in expects an array, got int"},
+		// 内置函数中的类型错误指向调用
+		{src: "2 * max(1, \"a\")", column: 5, msg: "mismatched types string and int for >"},
+	}
+	for _, test := range tests {
+		_, err := evaluator.Eval(test.src, Env{"a": 1})
+		var typeErr *TypeError
+		if !errors.As(err, &typeErr) {
+			t.Errorf("%q: expect *TypeError, but got %v", test.src, err)
+			continue
+		}
+		assert(t, typeErr.Column == test.column && typeErr.Node != nil && strings.Contains(typeErr.Msg, test.msg),
+			fmt.Sprintf("%q: unexpected error %+v", test.src, typeErr))
+	}
+	_, err := evaluator.Eval("max(1, \"a\")", Env{})
+	var callErr *TypeError
+	if errors.As(err, &callErr) {
+		_, ok := callErr.Node.(*CallExpression)
+		assert(t, ok && callErr.Line == 1, fmt.Sprintf("Expect the error to report the call, but got %+v", callErr))
+	} else {
+		t.Errorf("Expect *TypeError from max, but got %v", err)
+	}
+
+	evaluator.RegisterFunc("double", &Func{
+		Params: []Kind{KindInt},
+		Call: func(args []Value) (Value, error) {
+			return IntValue(args[0].Int() * 2), nil
+		},
+	})
+	_, err = evaluator.Eval("double(a)", Env{"a": "x"})
+	var typeErr *TypeError
+	assert(t, errors.As(err, &typeErr) && typeErr.Msg == "double: argument 1 must be int, got string",
+		fmt.Sprintf("unexpected error %v", err))
+	_, err = evaluator.Eval("double(\"x\")", Env{})
+	assert(t, errors.As(err, &typeErr) && typeErr.Column == 8, fmt.Sprintf("Expect Check to report a TypeError at the argument, but got %v", err))
+}
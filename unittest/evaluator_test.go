@@ -1,7 +1,9 @@
 package unittest
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	. "github.com/motto0808/go-calc/calc"
@@ -16,26 +18,26 @@ func evaluateContent(content string) int {
 
 func TestEvaluate(t *testing.T) {
 	{
-		s, _ := Evaluate(&ExpressionStatement{&NumberExpression{123}}, Env{})
+		s, _ := Evaluate(&ExpressionStatement{Expr: &NumberExpression{Val: 123}}, Env{})
 		assert(t, s == "123", fmt.Sprintf("Expect a statement \"123;\" to be evaluated as \"123\", but got %q", s))
 	}
 	{
-		s, err := Evaluate(&ExpressionStatement{&IdentifierExpression{"a"}}, Env{})
+		s, err := Evaluate(&ExpressionStatement{Expr: &IdentifierExpression{Lit: "a"}}, Env{})
 		assert(t, err != nil, "Expect an undefined variable \"a\" not to be evaluated, but got %q", s)
 	}
 	{
 		env := Env{"a": 16}
-		s, _ := Evaluate(&VarDefStatement{"a", &NumberExpression{123}}, env)
+		s, _ := Evaluate(&VarDefStatement{VarName: "a", Expr: &NumberExpression{Val: 123}}, env)
 		assert(t, s == "Assign 123 to a", "Expect a VarDef statement do an assignment, but it didn't")
 		assert(t, env["a"] == 123, "Expect a VarDef statement do an assignment, but it didn't")
 	}
 	{
-		s, err := Evaluate(&VarDefStatement{"a", &IdentifierExpression{"a"}}, Env{})
+		s, err := Evaluate(&VarDefStatement{VarName: "a", Expr: &IdentifierExpression{Lit: "a"}}, Env{})
 		assert(t, err != nil, fmt.Sprintf("Expect an undefined variable \"a\" not to be evaluated, but got %q", s))
 	}
 	{
 		env := Env{"b": 16}
-		s, err := Evaluate(&VarDefStatement{"a", &IdentifierExpression{"b"}}, env)
+		s, err := Evaluate(&VarDefStatement{VarName: "a", Expr: &IdentifierExpression{Lit: "b"}}, env)
 		assert(t, err == nil, "VarDef statement error")
 		assert(t, s == "Assign 16 to a", "Expect a VarDef statement do an assignment, but it didn't")
 		assert(t, env["a"] == 16, "Expect a VarDef statement do an assignment, but it didn't")
@@ -43,116 +45,215 @@ func TestEvaluate(t *testing.T) {
 }
 
 func TestEvaluateExpr(t *testing.T) {
-	if v, _ := EvaluateExpr(&NumberExpression{123}, Env{}); v != 123 {
+	if v, _ := EvaluateExpr(&NumberExpression{Val: 123}, Env{}); v != 123 {
 		t.Error("Expect a number 123 to be evaluated as 123, but got", v)
 	}
-	if v, _ := EvaluateExpr(&IdentifierExpression{"a"}, Env{"a": 123}); v != 123 {
+	if v, _ := EvaluateExpr(&IdentifierExpression{Lit: "a"}, Env{"a": 123}); v != 123 {
 		t.Error("Expect a variable \"a\" to be evaluated as 123, but got", v)
 	}
-	if v, err := EvaluateExpr(&IdentifierExpression{"a"}, Env{}); err == nil {
+	if v, err := EvaluateExpr(&IdentifierExpression{Lit: "a"}, Env{}); err == nil {
 		t.Error("Expect an undefined variable \"a\" not to be evaluated, but got", v)
 	}
-	if v, _ := EvaluateExpr(&UnaryMinusExpression{&NumberExpression{123}}, Env{}); v != -123 {
+	if v, _ := EvaluateExpr(&UnaryMinusExpression{SubExpr: &NumberExpression{Val: 123}}, Env{}); v != -123 {
 		t.Error("Expect a number -123 to be evaluated as -123, but got", v)
 	}
-	if v, err := EvaluateExpr(&UnaryMinusExpression{&IdentifierExpression{"a"}}, Env{}); err == nil {
+	if v, err := EvaluateExpr(&UnaryMinusExpression{SubExpr: &IdentifierExpression{Lit: "a"}}, Env{}); err == nil {
 		t.Error("Expect an undefined variable \"a\" not to be evaluated, but got", v)
 	}
-	if v, _ := EvaluateExpr(&ParenExpression{&NumberExpression{123}}, Env{}); v != 123 {
+	if v, _ := EvaluateExpr(&ParenExpression{SubExpr: &NumberExpression{Val: 123}}, Env{}); v != 123 {
 		t.Error("Expect an expression (123) to be evaluated as 123, but got", v)
 	}
-	if v, err := EvaluateExpr(&ParenExpression{&IdentifierExpression{"a"}}, Env{}); err == nil {
+	if v, err := EvaluateExpr(&ParenExpression{SubExpr: &IdentifierExpression{Lit: "a"}}, Env{}); err == nil {
 		t.Error("Expect an undefined variable \"a\" not to be evaluated, but got", v)
 	}
 
-	expr1 := &NumberExpression{42}
-	expr2 := &NumberExpression{12}
-	expr3 := &NumberExpression{26}
-	exprE := &IdentifierExpression{"a"}
-	if v, _ := EvaluateExpr(&BinOpExpression{expr1, '+', expr2}, Env{}); v != 54 {
+	expr1 := &NumberExpression{Val: 42}
+	expr2 := &NumberExpression{Val: 12}
+	expr3 := &NumberExpression{Val: 26}
+	exprE := &IdentifierExpression{Lit: "a"}
+	if v, _ := EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: '+', RHS: expr2}, Env{}); v != 54 {
 		t.Error("Expect an expression 42+12 to be evaluated as 54, but got", v)
 	}
-	if v, _ := EvaluateExpr(&BinOpExpression{expr1, '-', expr2}, Env{}); v != 30 {
+	if v, _ := EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: '-', RHS: expr2}, Env{}); v != 30 {
 		t.Error("Expect an expression 42-12 to be evaluated as 30, but got", v)
 	}
-	if v, _ := EvaluateExpr(&BinOpExpression{expr1, '*', expr2}, Env{}); v != 504 {
+	if v, _ := EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: '*', RHS: expr2}, Env{}); v != 504 {
 		t.Error("Expect an expression 42*12 to be evaluated as 3, but got", v)
 	}
-	if v, _ := EvaluateExpr(&BinOpExpression{expr1, '/', expr2}, Env{}); v != 3 {
+	if v, _ := EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: '/', RHS: expr2}, Env{}); v != 3 {
 		t.Error("Expect an expression 42/12 to be evaluated as 3, but got", v)
 	}
-	if v, _ := EvaluateExpr(&BinOpExpression{expr1, '%', expr2}, Env{}); v != 6 {
+	if v, _ := EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: '%', RHS: expr2}, Env{}); v != 6 {
 		t.Error("Expect an expression 42%12 to be evaluated as 6, but got", v)
 	}
-	if v, _ := EvaluateExpr(&BinOpExpression{expr1, '+', expr3}, Env{}); v != 68 {
+	if v, _ := EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: '+', RHS: expr3}, Env{}); v != 68 {
 		t.Error("Expect an expression 42+0x1A to be evaluated as 68, but got", v)
 	}
-	if v, err := EvaluateExpr(&BinOpExpression{exprE, '+', expr2}, Env{}); err == nil {
+	if v, err := EvaluateExpr(&BinOpExpression{LHS: exprE, Operator: '+', RHS: expr2}, Env{}); err == nil {
 		t.Error("Expect an undefined variable \"a\" not to be evaluated, but got", v)
 	}
-	if v, err := EvaluateExpr(&BinOpExpression{expr1, '+', exprE}, Env{}); err == nil {
+	if v, err := EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: '+', RHS: exprE}, Env{}); err == nil {
 		t.Error("Expect an undefined variable \"a\" not to be evaluated, but got", v)
 	}
 }
 
 func TestEvaluateCompareExpr(t *testing.T) {
-	expr1 := &NumberExpression{42}
-	expr2 := &NumberExpression{12}
-	expr3 := &UnaryMinusExpression{&NumberExpression{123}}
+	expr1 := &NumberExpression{Val: 42}
+	expr2 := &NumberExpression{Val: 12}
+	expr3 := &UnaryMinusExpression{SubExpr: &NumberExpression{Val: 123}}
 	env := Env{"a": 42, "b": -1}
 	var v int = 0
-	v, _ = EvaluateExpr(&BinOpExpression{expr1, NE, expr2}, Env{})
+	v, _ = EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: NE, RHS: expr2}, Env{})
 	assert(t, v == 1, "test NE")
 
-	v, _ = EvaluateExpr(&BinOpExpression{expr1, EQ, &IdentifierExpression{"a"}}, env)
+	v, _ = EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: EQ, RHS: &IdentifierExpression{Lit: "a"}}, env)
 	assert(t, v == 1, "test EQ")
-	v, _ = EvaluateExpr(&BinOpExpression{expr1, GT, expr2}, Env{})
+	v, _ = EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: GT, RHS: expr2}, Env{})
 	assert(t, v == 1, "test GT")
-	v, _ = EvaluateExpr(&BinOpExpression{expr1, GT, expr1}, Env{})
+	v, _ = EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: GT, RHS: expr1}, Env{})
 	assert(t, v == 0, "test GT")
-	v, _ = EvaluateExpr(&BinOpExpression{expr1, GE, expr1}, Env{})
+	v, _ = EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: GE, RHS: expr1}, Env{})
 	assert(t, v == 1, "test GE")
 
-	v, _ = EvaluateExpr(&BinOpExpression{expr1, LT, &IdentifierExpression{"a"}}, env)
+	v, _ = EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: LT, RHS: &IdentifierExpression{Lit: "a"}}, env)
 	assert(t, v == 0, "test expr1 < a")
-	v, _ = EvaluateExpr(&BinOpExpression{expr1, LE, &IdentifierExpression{"a"}}, env)
+	v, _ = EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: LE, RHS: &IdentifierExpression{Lit: "a"}}, env)
 	assert(t, v == 1, "test LE")
-	v, _ = EvaluateExpr(&BinOpExpression{expr3, LE, &IdentifierExpression{"b"}}, env)
+	v, _ = EvaluateExpr(&BinOpExpression{LHS: expr3, Operator: LE, RHS: &IdentifierExpression{Lit: "b"}}, env)
 	assert(t, v == 1, "test LE")
 
 }
 func TestEvaluateLogicExpr(t *testing.T) {
 	env := Env{"a": 42, "b": -1}
-	expr1 := &NumberExpression{42}
-	expr2 := &NumberExpression{0}
+	expr1 := &NumberExpression{Val: 42}
+	expr2 := &NumberExpression{Val: 0}
 	var v int = 0
-	v, _ = EvaluateExpr(&BinOpLogicExpression{expr1, LAND, expr2}, env)
+	v, _ = EvaluateExpr(&BinOpLogicExpression{LHS: expr1, Operator: LAND, RHS: expr2}, env)
 	assert(t, v == 0, "test expr1 && expr2")
-	v, _ = EvaluateExpr(&BinOpLogicExpression{expr2, LAND, expr1}, env)
+	v, _ = EvaluateExpr(&BinOpLogicExpression{LHS: expr2, Operator: LAND, RHS: expr1}, env)
 	assert(t, v == 0, "test expr2 && expr1")
-	v, _ = EvaluateExpr(&BinOpLogicExpression{expr1, LOR, expr2}, env)
+	v, _ = EvaluateExpr(&BinOpLogicExpression{LHS: expr1, Operator: LOR, RHS: expr2}, env)
 	assert(t, v == 1, "test expr1 || expr2")
-	v, _ = EvaluateExpr(&BinOpLogicExpression{expr2, LOR, expr1}, env)
+	v, _ = EvaluateExpr(&BinOpLogicExpression{LHS: expr2, Operator: LOR, RHS: expr1}, env)
 	assert(t, v == 1, "test expr2 || expr1")
 }
 func TestLargeNum(t *testing.T) {
-	expr1 := &NumberExpression{999999999}
-	expr2 := &NumberExpression{999999999}
-	v, _ := EvaluateExpr(&BinOpExpression{expr1, '+', expr2}, Env{})
+	expr1 := &NumberExpression{Val: 999999999}
+	expr2 := &NumberExpression{Val: 999999999}
+	v, _ := EvaluateExpr(&BinOpExpression{LHS: expr1, Operator: '+', RHS: expr2}, Env{})
 	assert(t, v == 1999999998)
 }
 
 func TestArray(t *testing.T) {
-	expr1 := &NumberExpression{1}
-	expr2 := &NumberExpression{2}
+	expr1 := &NumberExpression{Val: 1}
+	expr2 := &NumberExpression{Val: 2}
 	expr3 := &InExpression{LHS: expr1}
-	expr3.Arr = append(expr3.Arr, *expr1)
-	expr3.Arr = append(expr3.Arr, *expr2)
+	expr3.Arr = append(expr3.Arr, expr1)
+	expr3.Arr = append(expr3.Arr, expr2)
 
 	v, _ := EvaluateExpr(expr3, Env{})
 	assert(t, v == 1)
 }
 
+func TestNotInAndRange(t *testing.T) {
+	evaluator := NewEvaluator()
+	env := Env{"serverId": 7, "level": 15, "region": "cn", "rate": 6.0}
+	tests := []struct {
+		src    string
+		expect bool
+	}{
+		{src: "serverId not in [1, 2, 3]", expect: true},
+		{src: "serverId not in [7]", expect: false},
+		{src: "region not in [\"tw\", \"hk\"]", expect: true},
+		{src: "level in [10..20]", expect: true},
+		{src: "level in [16..20]", expect: false},
+		{src: "level in [15..15] && 10 in [10..20] && 20 in [10..20]", expect: true},
+		{src: "serverId in [1, 5..9, 100]", expect: true},
+		{src: "serverId in [1, 8..9, 100]", expect: false},
+		{src: "rate in [5..6] && !(6.5 in [5..7])", expect: true},
+		{src: "region in [1..10]", expect: false},
+		{src: "serverId not in [0x1..0x6, 8..10, 100]", expect: true},
+		{src: "level not in [10..20]", expect: false},
+		{src: "!(level not in [1, 2, 3, 4, 15])", expect: true},
+		{src: "serverId not in [1, 2, 3, 4, 5..6]", expect: true},
+		// 区间的上下界可以是负数
+		{src: "-3 in [-5..-1]", expect: true},
+		{src: "-6 in [-5..-1] || 0 in [-5..-1]", expect: false},
+		{src: "level - 20 in [-10..0] && -level in [-20..-10, 1, 2, 3]", expect: true},
+		{src: "-serverId not in [-6..6, 1, 2, 3]", expect: true},
+	}
+	for _, test := range tests {
+		v, err := evaluator.EvalValue(test.src, env)
+		assert(t, err == nil && v.Kind() == KindBool && v.Bool() == test.expect,
+			fmt.Sprintf("%q: expect %v, but got %v %v", test.src, test.expect, v, err))
+	}
+
+	v, err := evaluator.EvalValue("var r = [-2..0];\nlen(r) == 3 && -2 in r;\n", env)
+	assert(t, err == nil && v.Bool(), fmt.Sprintf("Expect negative ranges to be expanded, but got %v %v", v, err))
+
+	n, err := evaluator.Eval("true in [0..1]", env)
+	assert(t, err == nil && n == 1, "Expect bools to match ranges in non-strict mode")
+	evaluator.SetStrict(true)
+	n, err = evaluator.Eval("true in [0..1]", env)
+	assert(t, err == nil && n == 0, "Expect bools not to match ranges in strict mode")
+}
+
+func TestDynamicArray(t *testing.T) {
+	evaluator := NewEvaluator()
+	env := Env{
+		"serverId": 7,
+		"a":        6,
+		"allowed":  []int{1, 7, 9},
+		"regions":  []string{"cn", "tw"},
+		"mixed":    []interface{}{1.5, "x", true},
+	}
+	tests := []struct {
+		src    string
+		expect bool
+	}{
+		{src: "serverId in [a, a + 1]", expect: true},
+		{src: "serverId in [a * 2, max(a, 8)]", expect: false},
+		{src: "serverId in allowed", expect: true},
+		{src: "a in allowed", expect: false},
+		{src: "\"tw\" in regions && \"hk\" not in regions", expect: true},
+		{src: "1.5 in mixed && \"x\" in mixed && 1 in mixed", expect: true},
+		{src: "serverId in (a > 0 ? allowed : [])", expect: true},
+		{src: "serverId in [allowed]", expect: false},
+		{src: "len(allowed) == 3 && len([]) == 0", expect: true},
+	}
+	for _, test := range tests {
+		v, err := evaluator.EvalValue(test.src, env)
+		assert(t, err == nil && v.Kind() == KindBool && v.Bool() == test.expect,
+			fmt.Sprintf("%q: expect %v, but got %v %v", test.src, test.expect, v, err))
+	}
+
+	// 数组作为值使用时区间会被展开，in后面的数组中的区间不会展开
+	env = Env{"x": 3}
+	v, err := evaluator.EvalValue("var arr = [1, x * 2, 10..12];\nx not in arr && 11 in arr && x * 2 in arr;\n", env)
+	assert(t, err == nil && v.Bool(), fmt.Sprintf("unexpected result %v %v", v, err))
+	arr, ok := env["arr"].([]interface{})
+	assert(t, ok && fmt.Sprint(arr) == "[1 6 10 11 12]", fmt.Sprintf("unexpected array %#v", env["arr"]))
+
+	for _, src := range []string{"1 in x", "var r = [1..10000000]", "[1] == [1]", "-[1]", "[1] + 1"} {
+		_, err := evaluator.Eval(src, env)
+		assert(t, err != nil, fmt.Sprintf("Expect %q to fail", src))
+	}
+	n, err := evaluator.Eval("10000000 in [1..10000000]", env)
+	assert(t, err == nil && n == 1, fmt.Sprintf("unexpected result %v %v", n, err))
+	_, err = evaluator.Eval("1 in x", env)
+	assert(t, strings.Contains(err.Error(), "in expects an array, got int"), fmt.Sprintf("unexpected error %v", err))
+}
+
+func TestArrayValue(t *testing.T) {
+	v, err := ValueOf([]interface{}{1, "a", []float64{1.5}})
+	assert(t, err == nil && v.Kind() == KindArray && len(v.Array()) == 3, fmt.Sprintf("unexpected value %v %v", v, err))
+	assert(t, v.String() == "[1, a, [1.5]]", fmt.Sprintf("unexpected string %q", v.String()))
+	assert(t, fmt.Sprint(v.Interface()) == "[1 a [1.5]]", fmt.Sprintf("unexpected interface %v", v.Interface()))
+	assert(t, v.Bool() && !ArrayValue(nil).Bool(), "Expect only non-empty arrays to be true")
+	_, err = ValueOf([]interface{}{1, struct{}{}})
+	assert(t, err != nil, "Expect unsupported elements to be rejected")
+}
+
 func TestConditionExpr(t *testing.T) {
 	{
 		env := Env{"a": 16}
@@ -194,3 +295,253 @@ func TestMultiStatement(t *testing.T) {
 	n := evaluateContent("var a=1;var b=a>10?a:10;a+b")
 	assert(t, n == 11, "Expect 11, but it didn't")
 }
+
+func TestEvaluateErrorPosition(t *testing.T) {
+	_, err := NewEvaluator().Eval("var a = 1;\nvar b = a + foo;\n", Env{})
+	assert(t, err != nil && strings.Contains(err.Error(), "Line 2, Column 13: undefined variable: foo"),
+		fmt.Sprintf("unexpected error %v", err))
+}
+
+func TestFloat(t *testing.T) {
+	evaluator := NewEvaluator()
+	v, err := evaluator.EvalValue("charge*1.5", Env{"charge": 300})
+	assert(t, err == nil && v.Kind() == KindFloat && v.Float() == 450, fmt.Sprintf("unexpected result %v %v", v, err))
+
+	v, _ = evaluator.EvalValue("7/2", Env{})
+	assert(t, v.Kind() == KindInt && v.Int() == 3, "Expect integer division")
+	v, _ = evaluator.EvalValue("7/2.0", Env{})
+	assert(t, v.Kind() == KindFloat && v.Float() == 3.5, "Expect float division")
+	v, _ = evaluator.EvalValue("7.5%2", Env{})
+	assert(t, v.Float() == 1.5, "Expect float modulo")
+	v, _ = evaluator.EvalValue("-ratio", Env{"ratio": float32(0.5)})
+	assert(t, v.Float() == -0.5, "Expect float negation")
+
+	assert(t, evaluateContent("1 == 1.0") == 1, "Expect 1 == 1.0")
+	assert(t, evaluateContent("2 > 1.5 && 1.5 >= 1.5") == 1, "Expect float comparison")
+	assert(t, evaluateContent("0.0 ? 1 : 2") == 2, "Expect 0.0 to be false")
+	assert(t, evaluateContent("2.9") == 2, "Expect Eval to truncate float results")
+
+	env := Env{}
+	evaluator.Eval("var rate = 1.5e2;", env)
+	assert(t, env["rate"] == 150.0, fmt.Sprintf("Expect a float variable, but got %v", env["rate"]))
+	s, _ := Evaluate(&ExpressionStatement{Expr: &FloatExpression{Val: 0.25}}, Env{})
+	assert(t, s == "0.25", fmt.Sprintf("Expect \"0.25\", but got %q", s))
+
+	_, err = evaluator.Eval("a + 1", Env{"a": struct{}{}})
+	assert(t, err != nil, "Expect unsupported Env values to be rejected")
+}
+
+func TestString(t *testing.T) {
+	evaluator := NewEvaluator()
+	env := Env{"channel": "appstore", "region": "cn"}
+	assert(t, evaluateContent(`"abc" == "abc"`) == 1, "Expect string equality")
+	assert(t, evaluateContent(`"abc" < "abd" && "b" > "abc"`) == 1, "Expect string ordering")
+	n, _ := evaluator.Eval(`channel != "googleplay"`, env)
+	assert(t, n == 1, "Expect string inequality")
+	n, _ = evaluator.Eval(`region in ["cn", "tw", "hk"] && !(channel in ["googleplay"])`, env)
+	assert(t, n == 1, "Expect string list membership")
+	n, _ = evaluator.Eval(`1.0 in ["1", 2, 1]`, env)
+	assert(t, n == 1, "Expect mixed list membership")
+
+	v, err := evaluator.EvalValue(`region + "-" + channel`, env)
+	assert(t, err == nil && v.Kind() == KindString && v.Str() == "cn-appstore", fmt.Sprintf("unexpected result %v %v", v, err))
+	v, _ = evaluator.EvalValue(`"tab\t\"quoted\"\n"`, env)
+	assert(t, v.Str() == "tab\t\"quoted\"\n", fmt.Sprintf("unexpected escapes %q", v.Str()))
+
+	evaluator.Eval(`var name = "vip" + region;`, env)
+	assert(t, env["name"] == "vipcn", fmt.Sprintf("Expect a string variable, but got %v", env["name"]))
+
+	// 单行脚本中的非ASCII字符，按字符而不是字节判断结尾的分号
+	v, err = evaluator.EvalValue(`"中文" + "名字"`, env)
+	assert(t, err == nil && v.Str() == "中文名字", fmt.Sprintf("unexpected non-ASCII result %v %v", v, err))
+	v, err = evaluator.EvalValue(`"中文";`, env)
+	assert(t, err == nil && v.Str() == "中文", fmt.Sprintf("unexpected non-ASCII result %v %v", v, err))
+
+	_, err = evaluator.Eval(`region + 1`, env)
+	assert(t, err != nil, "Expect string + int to fail")
+	_, err = evaluator.Eval(`region > 1`, env)
+	assert(t, err != nil, "Expect string > int to fail")
+	_, err = evaluator.Eval(`-region`, env)
+	assert(t, err != nil, "Expect -string to fail")
+}
+
+func TestBitwise(t *testing.T) {
+	evaluator := NewEvaluator()
+	env := Env{"flags": 0x5, "vip": 3}
+	tests := []struct {
+		src    string
+		expect string
+	}{
+		{"flags & 4 != 0", "true"},
+		{"flags & 2", "0"},
+		{"flags | 2", "7"},
+		{"flags ^ 1", "4"},
+		{"~flags", "-6"},
+		{"1 << vip", "8"},
+		{"-16 >> 2", "-4"},
+		{"1 << 64", "0"},
+		{"flags & (1 << 2) == 1 << 2 && vip | 0 == vip", "true"},
+		{"true | 2", "3"},
+	}
+	for _, test := range tests {
+		v, err := evaluator.EvalValue(test.src, env)
+		assert(t, err == nil && v.String() == test.expect, fmt.Sprintf("Expect %q to be %s, but got %v %v", test.src, test.expect, v, err))
+	}
+	for _, src := range []string{"1.5 & 1", "\"a\" | 1", "1 << -1", "~1.5", "flags & & 1"} {
+		_, err := evaluator.Eval(src, env)
+		assert(t, err != nil, fmt.Sprintf("Expect %q to fail", src))
+	}
+	_, err := evaluator.Eval("1 << -vip", env)
+	assert(t, err != nil && strings.Contains(err.Error(), "negative shift count -3"), fmt.Sprintf("unexpected error %v", err))
+	evaluator.SetStrict(true)
+	_, err = evaluator.Eval("true | 2", env)
+	assert(t, err != nil, "Expect bools not to be used as integers in strict mode")
+}
+
+func TestPow(t *testing.T) {
+	evaluator := NewEvaluator()
+	env := Env{"base": 3, "level": 4}
+	tests := []struct {
+		src    string
+		expect string
+	}{
+		{"base ** level", "81"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"(-2) ** 3", "-8"},
+		{"2 ** 62", "4611686018427387904"},
+		{"(-2) ** 63", "-9223372036854775808"},
+		{"2 ** -1", "0.5"},
+		{"2.0 ** 0.5 == sqrt(2.0)", "true"},
+		{"0 ** 0 + 1 ** 1000000000 + (-1) ** 1000000001", "1"},
+		{"pow(base, 2)", "9"},
+		{"sqrt(80)", "8"},
+		{"sqrt(81)", "9"},
+		{"sqrt(9223372036854775807)", "3037000499"},
+		{"sqrt(0)", "0"},
+		{"log2(1)", "0"},
+		{"log2(1023)", "9"},
+		{"log2(8.0) + 0.5", "3.5"},
+	}
+	for _, test := range tests {
+		v, err := evaluator.EvalValue(test.src, env)
+		assert(t, err == nil && v.String() == test.expect, fmt.Sprintf("Expect %q to be %s, but got %v %v", test.src, test.expect, v, err))
+	}
+	for _, src := range []string{"2 ** 63", "10 ** 19", "(-3) ** 40", "\"a\" ** 2", "sqrt(-1)", "log2(0)", "log2(-1.5)", "pow(1)"} {
+		_, err := evaluator.Eval(src, env)
+		assert(t, err != nil, fmt.Sprintf("Expect %q to fail", src))
+	}
+	_, err := evaluator.Eval("base ** 100", env)
+	assert(t, err != nil && strings.Contains(err.Error(), "Line 1, Column 1: integer overflow: 3 ** 100"), fmt.Sprintf("unexpected error %v", err))
+}
+
+func TestDivisionByZero(t *testing.T) {
+	evaluator := NewEvaluator()
+	env := Env{"a": 7, "zero": 0}
+	for _, src := range []string{"a / zero", "a % zero", "a / (zero * 2)", "var b = 1;\nb % 0;\n"} {
+		_, err := evaluator.Eval(src, env)
+		var evalErr *EvalError
+		assert(t, errors.As(err, &evalErr) && errors.Is(err, ErrDivisionByZero), fmt.Sprintf("%q: unexpected error %v", src, err))
+	}
+	_, err := evaluator.Eval("var x = 1;\nx + a / zero;\n", env)
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) {
+		t.Fatalf("Expect *EvalError, but got %v", err)
+	}
+	_, ok := evalErr.Node.(*BinOpExpression)
+	assert(t, ok && evalErr.Line == 2 && evalErr.Column == 5, fmt.Sprintf("unexpected error %v", err))
+	assert(t, strings.Contains(err.Error(), "Line 2, Column 5: division by zero"), fmt.Sprintf("unexpected error %v", err))
+
+	// 浮点数除以0不是错误
+	v, err := evaluator.EvalValue("a / 0.0 > 1000 && a % 1.5 == 1", env)
+	assert(t, err == nil && v.Bool(), fmt.Sprintf("unexpected result %v %v", v, err))
+}
+
+func TestChecked(t *testing.T) {
+	evaluator := NewEvaluator()
+	env := Env{"max": 9223372036854775807, "min": -9223372036854775808}
+	overflows := []string{"max + 1", "min - 1", "max * 2", "min * -1", "-1 * min", "min / -1", "-min", "1 - min", "-(max + 1)", "abs(min)"}
+	for _, src := range overflows {
+		_, err := evaluator.Eval(src, env)
+		assert(t, err == nil, fmt.Sprintf("Expect %q to wrap without checking, but got %v", src, err))
+	}
+	evaluator.SetChecked(true)
+	for _, src := range overflows {
+		_, err := evaluator.Eval(src, env)
+		var evalErr *EvalError
+		assert(t, errors.As(err, &evalErr) && errors.Is(err, ErrIntegerOverflow) && evalErr.Line == 1,
+			fmt.Sprintf("Expect %q to overflow, but got %v", src, err))
+	}
+	for _, src := range []string{"max - 1 + 1", "min + 1 - 1", "max / -1", "min % -1", "-(min + 1)", "abs(min + 1)", "3037000499 * 3037000499", "max + 1.0 > max"} {
+		_, err := evaluator.Eval(src, env)
+		assert(t, err == nil, fmt.Sprintf("Expect %q not to overflow, but got %v", src, err))
+	}
+	_, err := evaluator.Eval("1 + max * 2", env)
+	assert(t, err != nil && strings.Contains(err.Error(), "Line 1, Column 5: integer overflow: 9223372036854775807 * 2"), fmt.Sprintf("unexpected error %v", err))
+}
+
+func TestBool(t *testing.T) {
+	evaluator := NewEvaluator()
+	v, err := evaluator.EvalValue("1 < 2", Env{})
+	assert(t, err == nil && v.Kind() == KindBool && v.Bool(), fmt.Sprintf("Expect a bool result, but got %v", v))
+	s, _ := Evaluate(&ExpressionStatement{Expr: &BoolExpression{Val: true}}, Env{})
+	assert(t, s == "true", fmt.Sprintf("Expect \"true\", but got %q", s))
+	assert(t, evaluateContent("true && !false") == 1, "Expect bool literals")
+	assert(t, evaluateContent("(1 < 2) + 5") == 6, "Expect bools to be promoted in non-strict mode")
+	assert(t, evaluateContent("(1 < 2) == 1") == 1, "Expect bools to equal 1 in non-strict mode")
+	n, _ := evaluator.Eval("vip ? 2 : 1", Env{"vip": true})
+	assert(t, n == 2, "Expect bool values in Env")
+
+	env := Env{}
+	evaluator.Eval("var ok = 3 > 2;", env)
+	assert(t, env["ok"] == true, fmt.Sprintf("Expect a bool variable, but got %v", env["ok"]))
+
+	strict := NewEvaluator()
+	strict.SetStrict(true)
+	for _, src := range []string{"(1 < 2) + 5", "-true", "1 ? 2 : 3", "1 && true", "false || 0", "!1", "true < false"} {
+		_, err := strict.Eval(src, Env{})
+		assert(t, err != nil, fmt.Sprintf("Expect %q to fail in strict mode", src))
+	}
+	n, err = strict.Eval("a > 1 && (b == 2 || !c) ? 10 : 20", Env{"a": 2, "b": 3, "c": false})
+	assert(t, err == nil && n == 10, fmt.Sprintf("unexpected result %v %v", n, err))
+	n, err = strict.Eval("(a > 1) == true && true != false", Env{"a": 2})
+	assert(t, err == nil && n == 1, fmt.Sprintf("unexpected result %v %v", n, err))
+}
+
+func TestBuiltin(t *testing.T) {
+	evaluator := NewEvaluator()
+	env := Env{"a": 3, "b": 8, "ratio": 2.5, "name": "勇者"}
+	cases := []struct {
+		src    string
+		expect string
+	}{
+		{"max(a, b)", "8"},
+		{"min(a, b, -1)", "-1"},
+		{"max(a, ratio)", "3"},
+		{"min(a, ratio)", "2.5"},
+		{`max("abc", "abd")`, "abd"},
+		{"abs(-a)", "3"},
+		{"abs(-ratio)", "2.5"},
+		{"abs(-9223372036854775807 - 1)", "-9223372036854775808"},
+		{"clamp(b, 0, 5)", "5"},
+		{"clamp(-b, 0, 5)", "0"},
+		{"clamp(a, 0, 5)", "3"},
+		{"len(name)", "2"},
+		{`len("")`, "0"},
+		{"len([a, b, 1..3])", "5"},
+		{"floor(ratio)", "2"},
+		{"ceil(ratio)", "3"},
+		{"round(ratio)", "3"},
+		{"round(-ratio)", "-3"},
+		{"floor(a)", "3"},
+		{"max(a, b) > 5 ? floor(b * 1.5) : 0", "12"},
+	}
+	for _, c := range cases {
+		v, err := evaluator.EvalValue(c.src, env)
+		assert(t, err == nil && v.String() == c.expect, fmt.Sprintf("Expect %q to be %s, but got %v %v", c.src, c.expect, v, err))
+	}
+	for _, src := range []string{"foo(1)", "max()", "abs(1, 2)", "clamp(1, 2)", "len(1)", `floor("a")`, `max(1, "a")`, "abs(c)"} {
+		_, err := evaluator.Eval(src, env)
+		assert(t, err != nil, fmt.Sprintf("Expect %q to fail", src))
+	}
+}
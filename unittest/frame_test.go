@@ -0,0 +1,124 @@
+package unittest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+type player struct {
+	Level  int
+	Gold   float64 `calc:"gold"`
+	Name   string
+	Secret int `calc:"-"`
+	hidden int
+}
+
+func TestProgramVars(t *testing.T) {
+	prog, err := Compile("var total = price * count;\ntotal > 10 && price in [1, 2];\n")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+	vars := prog.Vars()
+	assert(t, fmt.Sprint(vars) == "[price count total]", fmt.Sprintf("unexpected vars %v", vars))
+}
+
+// 遍历语法树求值时变量已经解析为槽位，结果必须与按变量名查找相同
+func TestProgramSlots(t *testing.T) {
+	for _, src := range []string{
+		"var c = a * b;\nc - a > 10 ? -c : c;\n",
+		"!(a > b) && (max(a, b) == b || name == \"x\")",
+		"a not in [1, 2, 3] && b in [a + 5, 9]",
+		"a not in [1, 2, 3, 4, 5]",
+		"var arr = [a, 8..10];\nb in arr && len(arr) == 4;\n",
+		"~a & b",
+	} {
+		prog, err := Compile(src)
+		assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+		got, err := prog.Run(Env{"a": 3, "b": 8, "name": "vip"})
+		expect, _ := NewEvaluator().EvalValue(src, Env{"a": 3, "b": 8, "name": "vip"})
+		assert(t, err == nil && got == expect, fmt.Sprintf("%q: expect %v, but got %v %v", src, expect, got, err))
+	}
+}
+
+func TestBindEnv(t *testing.T) {
+	prog, err := Compile("var total = price * count;\ntotal >= 100;\n")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+	env := Env{"price": 25, "count": 4, "unused": []int{1}}
+	f := prog.Bind(env)
+	v, err := prog.RunFrame(context.Background(), f)
+	assert(t, err == nil && v.Bool(), fmt.Sprintf("unexpected result %v %v", v, err))
+	total, ok := f.Get("total")
+	assert(t, ok && total.Int() == 100, fmt.Sprintf("unexpected total %v %v", total, ok))
+	_, ok = env["total"]
+	assert(t, !ok, "Expect Bind not to modify env")
+
+	// 无法转换的变量只有用到时才报错
+	prog, _ = Compile("true || bad")
+	v, err = prog.Run(Env{"bad": map[string]int{}})
+	assert(t, err == nil && v.Bool(), fmt.Sprintf("unexpected result %v %v", v, err))
+	prog, _ = Compile("bad")
+	_, err = prog.Run(Env{"bad": map[string]int{}})
+	assert(t, err != nil, "Expect unsupported variable type to fail")
+
+	other, _ := Compile("price")
+	_, err = other.RunFrame(context.Background(), f)
+	assert(t, err != nil, "Expect frames of another program to fail")
+}
+
+func TestBindStruct(t *testing.T) {
+	eva := NewEvaluator()
+	eva.SetCondHelper(&condHelper, nil)
+	prog, err := eva.Compile("Level >= 30 && gold > 1.5 && Name == \"bob\" && age == 20")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+	for _, x := range []interface{}{player{Level: 30, Gold: 2, Name: "bob"}, &player{Level: 31, Gold: 9.5, Name: "bob"}} {
+		f, err := prog.BindStruct(x)
+		assert(t, err == nil, fmt.Sprintf("bind failed %v", err))
+		v, err := prog.RunFrame(context.Background(), f)
+		assert(t, err == nil && v.Bool(), fmt.Sprintf("unexpected result %v %v", v, err))
+		age, ok := f.Get("age")
+		assert(t, ok && age.Int() == 20, "Expect condition results to be saved in the frame")
+	}
+
+	prog, _ = Compile("Secret + hidden")
+	f, err := prog.BindStruct(player{Secret: 1, hidden: 2})
+	assert(t, err == nil, fmt.Sprintf("bind failed %v", err))
+	_, err = prog.RunFrame(context.Background(), f)
+	assert(t, err != nil, "Expect ignored and unexported fields not to be bound")
+
+	_, err = prog.BindStruct(map[string]int{})
+	assert(t, err != nil, "Expect non-struct values to fail binding")
+}
+
+// 变量在编译时解析为槽位，求值时不再按变量名查找：变量名的长度不影响求值的耗时
+func BenchmarkSlotLookup(b *testing.B) {
+	for _, n := range []int{1, 1024} {
+		names := make([]string, 8)
+		env := Env{}
+		for i := range names {
+			names[i] = fmt.Sprintf("v%d%s", i, strings.Repeat("x", n))
+			env[names[i]] = i
+		}
+		src := fmt.Sprintf("var s = %s;\ns * 2 + %s;\n", strings.Join(names, " + "), strings.Join(names, " - "))
+		for _, backend := range []struct {
+			name    string
+			backend Backend
+		}{{"tree", BackendTree}, {"vm", BackendVM}} {
+			eva := NewEvaluator()
+			eva.SetBackend(backend.backend)
+			prog, err := eva.Compile(src)
+			if err != nil {
+				b.Fatal(err)
+			}
+			f := prog.Bind(env)
+			b.Run(fmt.Sprintf("%s/%d", backend.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := prog.RunFrame(context.Background(), f); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
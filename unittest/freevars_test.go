@@ -0,0 +1,51 @@
+package unittest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+func TestFreeVariables(t *testing.T) {
+	tests := []struct {
+		src   string
+		vars  string
+		calls string
+	}{
+		{"a + b * a;\n", "a,b", ""},
+		{"var x = 1;\nx + y;\n", "y", ""},
+		// 使用在定义之前，以及在定义自己的var语句中都是自由变量
+		{"x;\nvar x = 1;\nx;\n", "x", ""},
+		{"var a = a + 1;\na;\n", "a", ""},
+		{"max(a, 1) + itemCount(1001, b) + itemCount(c) + len(d);\n", "a,b,c,d", "itemCount"},
+		{"lvl in [1, x, 3..5] && y not in z ? -~u : (!v || w);\n", "lvl,x,y,z,u,v,w", ""},
+		{"1 + 2;\n", "", ""},
+	}
+	for _, test := range tests {
+		deps := FreeVariables(parseStatements(t, test.src))
+		vars, calls := strings.Join(deps.Vars, ","), strings.Join(deps.Calls, ",")
+		assert(t, vars == test.vars && calls == test.calls,
+			fmt.Sprintf("%q: unexpected dependencies %v %v", test.src, deps.Vars, deps.Calls))
+	}
+
+	// 注册的函数不是条件
+	eva := newFuncEvaluator(t)
+	deps := eva.FreeVariables(parseStatements(t, "hasItem(id) && vipLevel(x) > 1;\n"))
+	assert(t, strings.Join(deps.Calls, ",") == "vipLevel", fmt.Sprintf("unexpected calls %v", deps.Calls))
+	eva.SetCondHelper(&CondHelper{}, nil)
+	prog, err := eva.Compile("var total = charge + bonus;\ntotal >= 200 && hasItem(1001) && itemCount(1001) >= level;\n")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+	deps = prog.FreeVariables()
+	assert(t, strings.Join(deps.Vars, ",") == "charge,bonus,level" && strings.Join(deps.Calls, ",") == "itemCount",
+		fmt.Sprintf("unexpected program dependencies %v %v", deps.Vars, deps.Calls))
+
+	fromEnv, conds := deps.Split(Env{"level": 30, "bonus": 0, "other": 1})
+	assert(t, strings.Join(fromEnv, ",") == "bonus,level" && strings.Join(conds, ",") == "charge",
+		fmt.Sprintf("unexpected split %v %v", fromEnv, conds))
+
+	// 忽略nil语句
+	deps = FreeVariables([]Statement{nil, &ExpressionStatement{Expr: &IdentifierExpression{Lit: "a"}}})
+	assert(t, strings.Join(deps.Vars, ",") == "a", fmt.Sprintf("unexpected vars %v", deps.Vars))
+}
@@ -0,0 +1,110 @@
+package unittest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+func newFuncEvaluator(t *testing.T) *Evaluator {
+	eva := NewEvaluator()
+	items := map[int]int{1001: 3, 1002: 0}
+	err := eva.RegisterFunc("hasItem", &Func{
+		Params: []Kind{KindInt},
+		Call: func(args []Value) (Value, error) {
+			return BoolValue(items[args[0].Int()] > 0), nil
+		},
+	})
+	assert(t, err == nil, "register hasItem")
+	err = eva.RegisterFunc("scale", &Func{
+		Params: []Kind{KindFloat, KindFloat},
+		Call: func(args []Value) (Value, error) {
+			return FloatValue(args[0].Float() * args[1].Float()), nil
+		},
+	})
+	assert(t, err == nil, "register scale")
+	err = eva.RegisterFunc("join", &Func{
+		Params:   []Kind{KindString, KindAny},
+		Variadic: true,
+		Call: func(args []Value) (Value, error) {
+			parts := make([]string, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				parts = append(parts, arg.String())
+			}
+			return StringValue(strings.Join(parts, args[0].Str())), nil
+		},
+	})
+	assert(t, err == nil, "register join")
+	err = eva.RegisterFunc("fail", &Func{
+		Params: []Kind{},
+		Call: func(args []Value) (Value, error) {
+			return Value{}, errors.New("boom")
+		},
+	})
+	assert(t, err == nil, "register fail")
+	return eva
+}
+
+func TestRegisterFunc(t *testing.T) {
+	eva := newFuncEvaluator(t)
+	n, err := eva.Eval("hasItem(1001) && !hasItem(1002)", Env{})
+	assert(t, err == nil && n == 1, fmt.Sprintf("unexpected result %v %v", n, err))
+	v, err := eva.EvalValue("scale(2, 1.5)", Env{})
+	assert(t, err == nil && v.Kind() == KindFloat && v.Float() == 3, fmt.Sprintf("unexpected result %v %v", v, err))
+	v, err = eva.EvalValue(`join("-")`, Env{})
+	assert(t, err == nil && v.Str() == "", fmt.Sprintf("unexpected result %v %v", v, err))
+	v, err = eva.EvalValue(`join("-", 1, "a", a)`, Env{"a": 2.5})
+	assert(t, err == nil && v.Str() == "1-a-2.5", fmt.Sprintf("unexpected result %v %v", v, err))
+
+	_, err = eva.Eval("fail()", Env{})
+	assert(t, err != nil && strings.Contains(err.Error(), "fail: boom"), fmt.Sprintf("unexpected error %v", err))
+
+	// 注册的函数可以覆盖内置函数
+	err = eva.RegisterFunc("max", &Func{Params: []Kind{KindAny}, Call: func(args []Value) (Value, error) {
+		return IntValue(42), nil
+	}})
+	assert(t, err == nil, "register max")
+	n, _ = eva.Eval("max(1)", Env{})
+	assert(t, n == 42, "Expect registered functions to override built-ins")
+	n, _ = NewEvaluator().Eval("max(1)", Env{})
+	assert(t, n == 1, "Expect registered functions to be local to the evaluator")
+
+	assert(t, eva.RegisterFunc("1abc", &Func{Call: func([]Value) (Value, error) { return Value{}, nil }}) != nil, "Expect invalid names to be rejected")
+	assert(t, eva.RegisterFunc("in", &Func{Call: func([]Value) (Value, error) { return Value{}, nil }}) != nil, "Expect keywords to be rejected")
+	assert(t, eva.RegisterFunc("nothing", &Func{}) != nil, "Expect functions without Call to be rejected")
+}
+
+func TestCheckFunc(t *testing.T) {
+	eva := newFuncEvaluator(t)
+	calls := 0
+	eva.RegisterFunc("count", &Func{Params: []Kind{}, Call: func([]Value) (Value, error) {
+		calls++
+		return IntValue(calls), nil
+	}})
+	// 在求值之前发现错误，前面的语句不会被执行
+	for _, src := range []string{
+		"count(); hasItem()",
+		"count(); hasItem(1, 2)",
+		`count(); hasItem("1001")`,
+		`count(); scale(1, "2")`,
+		`count(); join()`,
+		`count(); join(1, 2)`,
+		"count(); foo(1)",
+	} {
+		_, err := eva.Eval(src, Env{})
+		assert(t, err != nil, fmt.Sprintf("Expect %q to be rejected", src))
+	}
+	assert(t, calls == 0, fmt.Sprintf("Expect no statement to be evaluated, but count() was called %d times", calls))
+
+	// 非字面量参数只有求值时才能检查
+	_, err := eva.Eval("hasItem(a)", Env{"a": "1001"})
+	assert(t, err != nil && strings.Contains(err.Error(), "argument 1 must be int, got string"), fmt.Sprintf("unexpected error %v", err))
+
+	p := NewParser()
+	stmts := p.Parse("hasItem(1, 2);")
+	err = eva.Check(stmts)
+	assert(t, err != nil && strings.Contains(err.Error(), "Line 1, Column 1: hasItem expects 1 arguments, got 2"), fmt.Sprintf("unexpected error %v", err))
+}
@@ -0,0 +1,102 @@
+package unittest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+// 生成形如x in [0, 1, ..., n-1]的脚本
+func inScript(n int, extra ...string) string {
+	elements := make([]string, 0, n+len(extra))
+	for i := 0; i < n; i++ {
+		elements = append(elements, strconv.Itoa(i*3))
+	}
+	elements = append(elements, extra...)
+	return "x in [" + strings.Join(elements, ", ") + "]"
+}
+
+func parseWithThreshold(t testing.TB, src string, threshold int) []Statement {
+	old := InSetThreshold
+	defer func() { InSetThreshold = old }()
+	InSetThreshold = threshold
+	stmts, err := NewParser().ParseE(src)
+	if err != nil {
+		t.Fatalf("parse failed %v", err)
+	}
+	return stmts
+}
+
+func TestInSetParse(t *testing.T) {
+	stmts := parseWithThreshold(t, inScript(InSetThreshold), InSetThreshold)
+	_, ok := stmts[0].(*ExpressionStatement).Expr.(*InSetExpression)
+	assert(t, ok, "Expect large literal arrays to become hash sets")
+	stmts = parseWithThreshold(t, inScript(InSetThreshold-1), InSetThreshold)
+	_, ok = stmts[0].(*ExpressionStatement).Expr.(*InExpression)
+	assert(t, ok, "Expect small arrays to be scanned linearly")
+	stmts = parseWithThreshold(t, inScript(InSetThreshold, "9007199254740993"), InSetThreshold)
+	_, ok = stmts[0].(*ExpressionStatement).Expr.(*InExpression)
+	assert(t, ok, "Expect integers beyond 2^53 to be scanned linearly")
+	stmts = parseWithThreshold(t, "x in [-1, 2, 3, 4, -5.5]", 4)
+	in, ok := stmts[0].(*ExpressionStatement).Expr.(*InSetExpression)
+	assert(t, ok, "Expect negative numbers to be put into hash sets")
+	_, ok = in.Arr[0].(*UnaryMinusExpression)
+	assert(t, ok && in.Arr[0].Pos().Column == 7, fmt.Sprintf("unexpected negative elements %v", in.Arr))
+	stmts = parseWithThreshold(t, "x in [-a, 2, 3, 4]", 4)
+	_, ok = stmts[0].(*ExpressionStatement).Expr.(*InExpression)
+	assert(t, ok, "Expect negative variables to be scanned linearly")
+}
+
+// 哈希表与逐个比较的结果必须相同
+func TestInSetEquivalent(t *testing.T) {
+	src := inScript(10, "1.5", "0.0", "\"a\"", "\"\"", "true", "4.0", "-7", "-2.5", "9007199254740992.0", "100..200", "-20..-15")
+	set := parseWithThreshold(t, src, 1)
+	linear := parseWithThreshold(t, src, 1<<30)
+	_, ok := set[0].(*ExpressionStatement).Expr.(*InSetExpression)
+	assert(t, ok, "Expect a hash set")
+
+	values := []interface{}{0, 1, 3, 4, 5, 27, 28, 0.0, 3.0, 1.5, 2.5, -0.0, "a", "b", "", true, false, int64(9), uint8(6), -7, -7.0, -2.5, 2.5,
+		100, 150.0, 150.5, 201, -20, -17.0, -14,
+		// 超过2^53的整数按浮点数比较时等于2^53
+		9007199254740993, -9007199254740993, 9007199254740992, 9007199254740995, 9007199254740993.0}
+	for _, strict := range []bool{false, true} {
+		eva := NewEvaluator()
+		eva.SetStrict(strict)
+		for _, x := range values {
+			expect, err1 := eva.EvaluateStmtValue(linear[0], Env{"x": x})
+			got, err2 := eva.EvaluateStmtValue(set[0], Env{"x": x})
+			assert(t, err1 == nil && err2 == nil && expect == got,
+				fmt.Sprintf("%v (%T) strict=%v: linear %v %v, set %v %v", x, x, strict, expect, err1, got, err2))
+		}
+	}
+}
+
+// 用于确定InSetThreshold：比较不同长度的数组逐个比较和哈希表查找的耗时
+func BenchmarkIn(b *testing.B) {
+	old := InSetThreshold
+	defer func() { InSetThreshold = old }()
+	for _, n := range []int{1, 2, 4, 8, 16, 64, 1024} {
+		for _, mode := range []struct {
+			name      string
+			threshold int
+		}{{"linear", 1 << 30}, {"set", 1}} {
+			InSetThreshold = mode.threshold
+			prog, err := Compile(inScript(n))
+			if err != nil {
+				b.Fatal(err)
+			}
+			// 查找不存在的值，逐个比较时需要比较所有元素
+			env := Env{"x": 1}
+			b.Run(fmt.Sprintf("%s/%d", mode.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := prog.Run(env); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
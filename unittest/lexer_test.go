@@ -21,10 +21,19 @@ func testScanner(t *testing.T, src string, expectTok int) {
 func TestScanner(t *testing.T) {
 	testScanner(t, "var", VAR)
 	testScanner(t, "in", IN)
+	testScanner(t, "not", NOT)
+	testScanner(t, "..", DOTDOT)
+	testScanner(t, "true", TRUE)
+	testScanner(t, "false", FALSE)
 	testScanner(t, "abc", IDENT)
 	testScanner(t, "123", NUMBER)
 	testScanner(t, "0xff", NUMBER)
 	testScanner(t, "0x123ABC", NUMBER)
+	testScanner(t, "1.5", FLOAT)
+	testScanner(t, "1e3", FLOAT)
+	testScanner(t, "2.5E-3", FLOAT)
+	testScanner(t, `"abc"`, STRING)
+	testScanner(t, `"a\"b"`, STRING)
 	testScanner(t, "(", '(')
 	testScanner(t, ")", ')')
 	testScanner(t, ";", ';')
@@ -39,6 +48,13 @@ func TestScanner(t *testing.T) {
 	testScanner(t, "!=", NE)
 	testScanner(t, "&&", LAND)
 	testScanner(t, "||", LOR)
+	testScanner(t, "&", '&')
+	testScanner(t, "|", '|')
+	testScanner(t, "^", '^')
+	testScanner(t, "~", '~')
+	testScanner(t, "<<", SHL)
+	testScanner(t, ">>", SHR)
+	testScanner(t, "**", POW)
 	testScanner(t, "[", '[')
 	testScanner(t, "]", ']')
 	testScanner(t, ",", ',')
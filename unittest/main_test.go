@@ -0,0 +1,18 @@
+package unittest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/motto0808/go-calc/calc"
+)
+
+// 所有用例分别使用语法树和虚拟机各跑一遍，两种求值方式的结果必须相同
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 {
+		calc.DefaultBackend = calc.BackendVM
+		code = m.Run()
+	}
+	os.Exit(code)
+}
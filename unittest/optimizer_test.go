@@ -0,0 +1,121 @@
+package unittest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+func optimize(t *testing.T, eva *Evaluator, src string) []Statement {
+	stmts, err := NewParser().ParseE(src)
+	if err != nil {
+		t.Fatalf("parse %q failed %v", src, err)
+	}
+	return eva.Optimize(stmts)
+}
+
+func TestOptimize(t *testing.T) {
+	ident := func(name string) Expression { return &IdentifierExpression{Lit: name} }
+	not := func(x Expression) Expression { return &UnaryNotExpression{SubExpr: x} }
+	tests := []struct {
+		src    string
+		strict bool
+		expect Expression
+	}{
+		{src: "(3600*24)*7", expect: &NumberExpression{Val: 604800}},
+		{src: "-(1.5 + 1) * 2", expect: &FloatExpression{Val: -5}},
+		{src: "\"a\" + \"b\" == \"ab\"", expect: &BoolExpression{Val: true}},
+		{src: "max(1, 2.5) + len(\"abc\")", expect: &FloatExpression{Val: 5.5}},
+		{src: "1 << 3 | ~-2", expect: &NumberExpression{Val: 9}},
+		{src: "((a)) + (1 + 2)", expect: &BinOpExpression{LHS: ident("a"), Operator: '+', RHS: &NumberExpression{Val: 3}}},
+		{src: "1 && foo", expect: not(not(ident("foo")))},
+		{src: "true && a > 1", expect: &BinOpExpression{LHS: ident("a"), Operator: GT, RHS: &NumberExpression{Val: 1}}},
+		{src: "false && foo", expect: &BoolExpression{Val: false}},
+		{src: "1 + 1 == 2 || foo", expect: &BoolExpression{Val: true}},
+		{src: "foo || false", expect: not(not(ident("foo")))},
+		{src: "!!(a < 1)", expect: &BinOpExpression{LHS: ident("a"), Operator: LT, RHS: &NumberExpression{Val: 1}}},
+		{src: "foo && false", expect: &BinOpLogicExpression{LHS: ident("foo"), Operator: LAND, RHS: &BoolExpression{Val: false}}},
+		{src: "1 > 2 ? a : b", expect: ident("b")},
+		{src: "2 in [1, 2, 3]", expect: &BoolExpression{Val: true}},
+		{src: "1 / 0", expect: &BinOpExpression{LHS: &NumberExpression{Val: 1}, Operator: '/', RHS: &NumberExpression{Val: 0}}},
+		{src: "1 && foo", strict: true, expect: &BinOpLogicExpression{LHS: &NumberExpression{Val: 1}, Operator: LAND, RHS: ident("foo")}},
+		{src: "1 ? a : b", strict: true, expect: &TernaryExpression{Cond: &NumberExpression{Val: 1}, TrueExpr: ident("a"), FalseExpr: ident("b")}},
+		{src: "true + 1", strict: true, expect: &BinOpExpression{LHS: &BoolExpression{Val: true}, Operator: '+', RHS: &NumberExpression{Val: 1}}},
+	}
+	for _, test := range tests {
+		eva := NewEvaluator()
+		eva.SetStrict(test.strict)
+		stmts := optimize(t, eva, test.src)
+		stripPos(reflect.ValueOf(stmts))
+		expect := []Statement{&ExpressionStatement{Expr: test.expect}}
+		if !reflect.DeepEqual(stmts, expect) {
+			t.Errorf("Optimize(%q) = %#v, want %#v", test.src, stmts[0].(*ExpressionStatement).Expr, test.expect)
+		}
+	}
+}
+
+func TestOptimizeVarChain(t *testing.T) {
+	stmts := optimize(t, NewEvaluator(), "var day = 3600 * 24;\nvar week = day * 7;\nvar day = x;\nweek + day;\n")
+	stripPos(reflect.ValueOf(stmts))
+	expect := []Statement{
+		&VarDefStatement{VarName: "day", Expr: &NumberExpression{Val: 86400}},
+		&VarDefStatement{VarName: "week", Expr: &NumberExpression{Val: 604800}},
+		&VarDefStatement{VarName: "day", Expr: &IdentifierExpression{Lit: "x"}},
+		&ExpressionStatement{Expr: &BinOpExpression{LHS: &NumberExpression{Val: 604800}, Operator: '+', RHS: &IdentifierExpression{Lit: "day"}}},
+	}
+	assert(t, reflect.DeepEqual(stmts, expect), fmt.Sprintf("unexpected statements %#v", stmts))
+}
+
+func TestOptimizeInSet(t *testing.T) {
+	threshold := InSetThreshold
+	defer func() { InSetThreshold = threshold }()
+	InSetThreshold = 100
+	stmts, _ := NewParser().ParseE("a in [1, 2.5, \"x\", true]")
+	InSetThreshold = 4
+	optimized := NewEvaluator().Optimize(stmts)
+	_, ok := optimized[0].(*ExpressionStatement).Expr.(*InSetExpression)
+	assert(t, ok, "Expect literal arrays to become hash sets")
+	_, ok = stmts[0].(*ExpressionStatement).Expr.(*InExpression)
+	assert(t, ok, "Expect the original tree not to be modified")
+}
+
+// 优化前后的求值结果必须相同
+func TestOptimizeEquivalent(t *testing.T) {
+	tests := []string{
+		"var day = 3600 * 24;\nvar week = day * 7;\nweek / a;\n",
+		"a in [1, 2.0, 3] && !(b in [\"x\", \"y\"])",
+		"2.0 in [1, 2] && 1 in [true] && !(0.5 in [0, 1])",
+		"c in [1, 0] || c in [true]",
+		"a > 1 && true && (false || b == \"x\")",
+		"1 && c",
+		"c && 1",
+		"-(-a) * (1 + 2.5) - 1 / 0.0",
+		"(a > 2 ? \"big\" : \"small\") + b",
+		"true ? a : foo(1)",
+		"1 + true",
+		"!c",
+		"max(a, 1 + 1) + abs(-2)",
+	}
+	for _, strict := range []bool{false, true} {
+		eva := NewEvaluator()
+		eva.SetStrict(strict)
+		for _, src := range tests {
+			stmts, err := NewParser().ParseE(src)
+			assert(t, err == nil, fmt.Sprintf("parse %q failed %v", src, err))
+			var expect, got Value
+			var expectErr, gotErr error
+			env := Env{"a": 3, "b": "x", "c": true}
+			for _, s := range stmts {
+				expect, expectErr = eva.EvaluateStmtValue(s, env)
+			}
+			env = Env{"a": 3, "b": "x", "c": true}
+			for _, s := range eva.Optimize(stmts) {
+				got, gotErr = eva.EvaluateStmtValue(s, env)
+			}
+			assert(t, expect == got && (expectErr == nil) == (gotErr == nil),
+				fmt.Sprintf("%q strict=%v: expect %v %v, got %v %v", src, strict, expect, expectErr, got, gotErr))
+		}
+	}
+}
@@ -1,13 +1,39 @@
 package unittest
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	. "github.com/motto0808/go-calc/calc"
 )
 
+// 比较语法树时忽略节点的位置信息
+func stripPos(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			stripPos(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			stripPos(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(Span{}) {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				stripPos(v.Field(i))
+			}
+		}
+	}
+}
+
 func parseStmt(t *testing.T, src string, expect interface{}) {
 	s := new(Scanner)
 	s.Init(src)
@@ -16,6 +42,7 @@ func parseStmt(t *testing.T, src string, expect interface{}) {
 		t.Errorf("Expect %q to be parsed", src)
 		return
 	}
+	stripPos(reflect.ValueOf(statements[0]))
 	if !reflect.DeepEqual(statements[0], expect) {
 		t.Errorf("Expect %+#v to be %+#v", statements[0], expect)
 		return
@@ -23,8 +50,8 @@ func parseStmt(t *testing.T, src string, expect interface{}) {
 }
 
 func TestParseStatement(t *testing.T) {
-	parseStmt(t, "123;", &ExpressionStatement{&NumberExpression{123}})
-	parseStmt(t, "var a = 123;", &VarDefStatement{"a", &NumberExpression{123}})
+	parseStmt(t, "123;", &ExpressionStatement{Expr: &NumberExpression{Val: 123}})
+	parseStmt(t, "var a = 123;", &VarDefStatement{VarName: "a", Expr: &NumberExpression{Val: 123}})
 }
 
 func parseExpr(t *testing.T, src string, expect interface{}) {
@@ -36,6 +63,7 @@ func parseExpr(t *testing.T, src string, expect interface{}) {
 		return
 	}
 	if exprStmt, isExprStmt := statements[0].(*ExpressionStatement); isExprStmt {
+		stripPos(reflect.ValueOf(exprStmt.Expr))
 		if !reflect.DeepEqual(exprStmt.Expr, expect) {
 			t.Errorf("Expect %+#v to be %+#v", exprStmt.Expr, expect)
 			return
@@ -50,48 +78,179 @@ func parseExpr(t *testing.T, src string, expect interface{}) {
  * @return {*}
  */
 func expectError(t *testing.T, src string) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered while compile error", r)
-		}
-	}()
 	s := new(Scanner)
 	s.Init(src + ";")
-	statements := Parse(s)
-	if len(statements) > 0 {
-		t.Fail()
+	statements, err := ParseE(s)
+	if err == nil || len(statements) > 0 {
+		t.Errorf("Expect %q not to be parsed", src)
 	}
 }
 
 func TestParseExpr(t *testing.T) {
-	parseExpr(t, "123", &NumberExpression{123})
-	parseExpr(t, "0XFF", &NumberExpression{255})
-	parseExpr(t, "0xaa", &NumberExpression{170})
-	parseExpr(t, "abc", &IdentifierExpression{"abc"})
-	parseExpr(t, "-abc", &UnaryMinusExpression{&IdentifierExpression{"abc"}})
-	parseExpr(t, "(abc)", &ParenExpression{&IdentifierExpression{"abc"}})
-
-	aExp := &IdentifierExpression{"a"}
-	bExp := &IdentifierExpression{"b"}
-	parseExpr(t, "a+b", &BinOpExpression{aExp, '+', bExp})
-	parseExpr(t, "a-b", &BinOpExpression{aExp, '-', bExp})
-	parseExpr(t, "a*b", &BinOpExpression{aExp, '*', bExp})
-	parseExpr(t, "a/b", &BinOpExpression{aExp, '/', bExp})
-	parseExpr(t, "a%b", &BinOpExpression{aExp, '%', bExp})
-
-	parseExpr(t, "!a", &UnaryNotExpression{aExp})
-	parseExpr(t, "a==b", &BinOpExpression{aExp, EQ, bExp})
-	parseExpr(t, "a!=b", &BinOpExpression{aExp, NE, bExp})
-	parseExpr(t, "a>=b", &BinOpExpression{aExp, GE, bExp})
-	parseExpr(t, "a>b", &BinOpExpression{aExp, GT, bExp})
-	parseExpr(t, "a<=b", &BinOpExpression{aExp, LE, bExp})
-	parseExpr(t, "a<b", &BinOpExpression{aExp, LT, bExp})
+	parseExpr(t, "123", &NumberExpression{Val: 123})
+	parseExpr(t, "0XFF", &NumberExpression{Val: 255})
+	parseExpr(t, "0xaa", &NumberExpression{Val: 170})
+	parseExpr(t, "1.25", &FloatExpression{Val: 1.25})
+	parseExpr(t, `"a\tb"`, &StringExpression{Val: "a\tb"})
+	parseExpr(t, "abc", &IdentifierExpression{Lit: "abc"})
+	parseExpr(t, "-abc", &UnaryMinusExpression{SubExpr: &IdentifierExpression{Lit: "abc"}})
+	parseExpr(t, "(abc)", &ParenExpression{SubExpr: &IdentifierExpression{Lit: "abc"}})
+
+	aExp := &IdentifierExpression{Lit: "a"}
+	bExp := &IdentifierExpression{Lit: "b"}
+	parseExpr(t, "a+b", &BinOpExpression{LHS: aExp, Operator: '+', RHS: bExp})
+	parseExpr(t, "a-b", &BinOpExpression{LHS: aExp, Operator: '-', RHS: bExp})
+	parseExpr(t, "a*b", &BinOpExpression{LHS: aExp, Operator: '*', RHS: bExp})
+	parseExpr(t, "a/b", &BinOpExpression{LHS: aExp, Operator: '/', RHS: bExp})
+	parseExpr(t, "a%b", &BinOpExpression{LHS: aExp, Operator: '%', RHS: bExp})
+
+	// 位运算的优先级与Go语言相同
+	parseExpr(t, "~a", &UnaryBitNotExpression{SubExpr: aExp})
+	parseExpr(t, "a & 4 != 0", &BinOpExpression{LHS: &BinOpExpression{LHS: aExp, Operator: '&', RHS: &NumberExpression{Val: 4}}, Operator: NE, RHS: &NumberExpression{Val: 0}})
+	parseExpr(t, "a | b << 2", &BinOpExpression{LHS: aExp, Operator: '|', RHS: &BinOpExpression{LHS: bExp, Operator: SHL, RHS: &NumberExpression{Val: 2}}})
+	parseExpr(t, "a ^ b >> 1 + 1", &BinOpExpression{
+		LHS:      &BinOpExpression{LHS: aExp, Operator: '^', RHS: &BinOpExpression{LHS: bExp, Operator: SHR, RHS: &NumberExpression{Val: 1}}},
+		Operator: '+',
+		RHS:      &NumberExpression{Val: 1},
+	})
+
+	// 乘方是右结合的，并且比负号优先
+	two := &NumberExpression{Val: 2}
+	parseExpr(t, "a ** b ** 2", &BinOpExpression{LHS: aExp, Operator: POW, RHS: &BinOpExpression{LHS: bExp, Operator: POW, RHS: two}})
+	parseExpr(t, "-a ** 2", &UnaryMinusExpression{SubExpr: &BinOpExpression{LHS: aExp, Operator: POW, RHS: two}})
+	parseExpr(t, "a * b ** 2", &BinOpExpression{LHS: aExp, Operator: '*', RHS: &BinOpExpression{LHS: bExp, Operator: POW, RHS: two}})
+	parseExpr(t, "a ** -2", &BinOpExpression{LHS: aExp, Operator: POW, RHS: &UnaryMinusExpression{SubExpr: two}})
+
+	parseExpr(t, "!a", &UnaryNotExpression{SubExpr: aExp})
+	parseExpr(t, "a==b", &BinOpExpression{LHS: aExp, Operator: EQ, RHS: bExp})
+	parseExpr(t, "a!=b", &BinOpExpression{LHS: aExp, Operator: NE, RHS: bExp})
+	parseExpr(t, "a>=b", &BinOpExpression{LHS: aExp, Operator: GE, RHS: bExp})
+	parseExpr(t, "a>b", &BinOpExpression{LHS: aExp, Operator: GT, RHS: bExp})
+	parseExpr(t, "a<=b", &BinOpExpression{LHS: aExp, Operator: LE, RHS: bExp})
+	parseExpr(t, "a<b", &BinOpExpression{LHS: aExp, Operator: LT, RHS: bExp})
+
+	parseExpr(t, "f()", &CallExpression{Name: "f"})
+	parseExpr(t, "max(a, b+1)", &CallExpression{Name: "max", Args: []Expression{aExp, &BinOpExpression{LHS: bExp, Operator: '+', RHS: &NumberExpression{Val: 1}}}})
 
 	// condition expr
-	parseExpr(t, "a?1:3", &TernaryExpression{aExp, &NumberExpression{1}, &NumberExpression{3}})
+	parseExpr(t, "a?1:3", &TernaryExpression{Cond: aExp, TrueExpr: &NumberExpression{Val: 1}, FalseExpr: &NumberExpression{Val: 3}})
+
+	// in, not in以及整数区间
+	one := &NumberExpression{Val: 1}
+	parseExpr(t, "a in [1]", &InExpression{LHS: aExp, Arr: []Expression{one}})
+	parseExpr(t, "a not in [1]", &InExpression{LHS: aExp, Arr: []Expression{one}, Not: true})
+	parseExpr(t, "a in [10..20]", &InExpression{LHS: aExp, Arr: []Expression{&RangeExpression{Low: 10, High: 20}}})
+	parseExpr(t, "a not in [1, 5..9]", &InExpression{LHS: aExp, Arr: []Expression{one, &RangeExpression{Low: 5, High: 9}}, Not: true})
+	parseExpr(t, "a in [-5..-1, -3..2]", &InExpression{LHS: aExp, Arr: []Expression{&RangeExpression{Low: -5, High: -1}, &RangeExpression{Low: -3, High: 2}}})
+	parseExpr(t, "a in [-1, 1..2]", &InExpression{LHS: aExp, Arr: []Expression{&UnaryMinusExpression{SubExpr: one}, &RangeExpression{Low: 1, High: 2}}})
+	parseExpr(t, "a + 1 not in [1] && b", &BinOpLogicExpression{
+		LHS:      &InExpression{LHS: &BinOpExpression{LHS: aExp, Operator: '+', RHS: one}, Arr: []Expression{one}, Not: true},
+		Operator: LAND,
+		RHS:      bExp,
+	})
+
+	// 数组中的元素可以是任意表达式，in后面可以是任意表达式
+	parseExpr(t, "a in [b, b+1]", &InExpression{LHS: aExp, Arr: []Expression{bExp, &BinOpExpression{LHS: bExp, Operator: '+', RHS: one}}})
+	parseExpr(t, "a in b", &InExpression{LHS: aExp, RHS: bExp})
+	parseExpr(t, "a not in f(1) + b", &InExpression{LHS: aExp, Not: true,
+		RHS: &BinOpExpression{LHS: &CallExpression{Name: "f", Args: []Expression{one}}, Operator: '+', RHS: bExp}})
+	parseExpr(t, "[a, [1], 1..2]", &ArrayExpression{Arr: []Expression{aExp, &ArrayExpression{Arr: []Expression{one}}, &RangeExpression{Low: 1, High: 2}}})
 }
 
 func TestParseError(t *testing.T) {
 	expectError(t, "a<b<c")
 	expectError(t, "a<b>c")
+	expectError(t, "a not [1]")
+	expectError(t, "a & & b")
+	expectError(t, "a &")
+	expectError(t, "a in [1.5..3]")
+	expectError(t, "a in [1..b]")
+	expectError(t, "a in [..3]")
+	expectError(t, "a in [--1..3]")
+	expectError(t, "a in [1..-b]")
+}
+
+func TestParseRangeError(t *testing.T) {
+	_, err := NewParser().ParseE("a in [1, 20..10]")
+	var pe *ParseError
+	assert(t, errors.As(err, &pe) && pe.Line == 1 && pe.Column == 10, fmt.Sprintf("unexpected error %v", err))
+	_, err = NewParser().ParseE("a in [-1..-3]")
+	assert(t, errors.As(err, &pe) && pe.Column == 7 && pe.Lit == "-1..-3", fmt.Sprintf("unexpected error %v", err))
+
+	// 区间不合法的语句不算解析成功
+	statements, errs := NewParser().ParseAll("x in [5..1];\ny;\n")
+	assert(t, len(errs) == 1 && errs[0].Line == 1, fmt.Sprintf("unexpected errors %v", errs))
+	assert(t, len(statements) == 1 && statements[0].Pos().Line == 2, fmt.Sprintf("Expect only the valid statement, but got %d", len(statements)))
+}
+
+func TestParseErrorValue(t *testing.T) {
+	s := new(Scanner)
+	s.Init("var a = 1;\nvar b = a <;\n")
+	_, err := ParseE(s)
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expect a *ParseError, but got %v", err)
+	}
+	assert(t, pe.Line == 2 && pe.Column == 12, fmt.Sprintf("unexpected position %+v", pe.Position))
+	assert(t, pe.Lit == ";", fmt.Sprintf("unexpected literal %q", pe.Lit))
+
+	_, err = NewParser().ParseE("var 1 = 2")
+	assert(t, errors.As(err, &pe), "Expect a *ParseError")
+	assert(t, reflect.DeepEqual(pe.Expected, []string{"IDENT"}), fmt.Sprintf("unexpected expected tokens %v", pe.Expected))
+
+	p := NewParser()
+	_, err = p.ParseE("a @ b")
+	assert(t, errors.As(err, &pe), "Expect an unknown character to be reported")
+	assert(t, pe.Lit == "@" && pe.Column == 3, fmt.Sprintf("unexpected error %v", pe))
+
+	_, err = p.ParseE(`a == "abc`)
+	assert(t, errors.As(err, &pe) && pe.Msg == "string literal not terminated", fmt.Sprintf("unexpected error %v", err))
+
+	_, err = NewEvaluator().Eval("a<b<c", Env{})
+	assert(t, errors.As(err, &pe), "Expect Eval to return a *ParseError")
+}
+
+func TestParseAll(t *testing.T) {
+	src := "var a = 1;\nvar b = ;\na + ;\nvar c = a + 2;\nc * 3;\n"
+	statements, errs := NewParser().ParseAll(src)
+	assert(t, len(errs) == 2, fmt.Sprintf("Expect 2 errors, but got %v", errs))
+	assert(t, len(statements) == 3, fmt.Sprintf("Expect 3 statements, but got %d", len(statements)))
+	if len(errs) == 2 {
+		assert(t, errs[0].Line == 2 && errs[1].Line == 3, "unexpected error lines")
+	}
+
+	statements, errs = NewParser().ParseAll("var a = 1;\na * 2;\n")
+	assert(t, errs.Err() == nil && len(statements) == 2, "Expect no errors")
+}
+
+// 超出范围的数字字面量是语法错误，而不是得到Inf或者MaxInt
+func TestParseNumberRange(t *testing.T) {
+	for _, src := range []string{"1e400", "9223372036854775808", "0x8000000000000000", "a + 1.5e309"} {
+		_, err := NewParser().ParseE(src)
+		var pe *ParseError
+		assert(t, errors.As(err, &pe) && strings.Contains(pe.Msg, "out of range"), fmt.Sprintf("%q: unexpected error %v", src, err))
+	}
+	statements, err := NewParser().ParseE("9223372036854775807 + 0x7FFFFFFFFFFFFFFF + 1e308")
+	assert(t, err == nil && len(statements) == 1, fmt.Sprintf("unexpected error %v", err))
+
+	// 包含不合法的字面量的语句不算解析成功
+	statements, errs := NewParser().ParseAll("var a = 1e400;\nb;\nvar c = 99999999999999999999 + 1;\n")
+	assert(t, len(errs) == 2 && errs[0].Line == 1 && errs[1].Line == 3, fmt.Sprintf("unexpected errors %v", errs))
+	assert(t, len(statements) == 1 && statements[0].Pos().Line == 2, fmt.Sprintf("Expect only the valid statement, but got %d", len(statements)))
+}
+
+func TestParsePosition(t *testing.T) {
+	statements := NewParser().Parse("var a = 1;\n(a + foo) in [1, 2];\n")
+	assert(t, len(statements) == 2, "Expect 2 statements")
+	stmt := statements[1].(*ExpressionStatement)
+	assert(t, stmt.Pos() == Position{Line: 2, Column: 1} && stmt.End() == Position{Line: 2, Column: 21},
+		fmt.Sprintf("unexpected statement span %+v", stmt.Span))
+	in := stmt.Expr.(*InExpression)
+	assert(t, in.End() == Position{Line: 2, Column: 20}, fmt.Sprintf("unexpected in span %+v", in.Span))
+	add := in.LHS.(*ParenExpression).SubExpr.(*BinOpExpression)
+	assert(t, add.Pos() == Position{Line: 2, Column: 2} && add.End() == Position{Line: 2, Column: 9},
+		fmt.Sprintf("unexpected binop span %+v", add.Span))
+	foo := add.RHS.(*IdentifierExpression)
+	assert(t, foo.Pos() == Position{Line: 2, Column: 6} && foo.End() == Position{Line: 2, Column: 9},
+		fmt.Sprintf("unexpected identifier span %+v", foo.Span))
 }
@@ -0,0 +1,89 @@
+package unittest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+func TestCompile(t *testing.T) {
+	_, err := Compile("1 +")
+	assert(t, err != nil, "Expect syntax errors to fail compiling")
+	_, err = Compile("foo(1)")
+	assert(t, err != nil, "Expect undefined functions to fail compiling")
+
+	prog, err := Compile("var b = a * 2;\nb + 1;\n")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+	env := Env{"a": 3}
+	v, err := prog.Run(env)
+	assert(t, err == nil && v.Int() == 7, fmt.Sprintf("unexpected result %v %v", v, err))
+	_, ok := env["b"]
+	assert(t, !ok, "Expect Run not to modify env")
+
+	v, err = prog.Run(Env{"a": 10})
+	assert(t, err == nil && v.Int() == 21, fmt.Sprintf("unexpected result %v %v", v, err))
+}
+
+func TestCompileSnapshot(t *testing.T) {
+	eva := NewEvaluator()
+	eva.RegisterFunc("twice", &Func{
+		Params: []Kind{KindInt},
+		Call: func(args []Value) (Value, error) {
+			return IntValue(args[0].Int() * 2), nil
+		},
+	})
+	eva.SetCondHelper(&condHelper, nil)
+	prog, err := eva.Compile("twice(age)")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+
+	eva.RegisterFunc("twice", &Func{
+		Params: []Kind{KindInt},
+		Call: func(args []Value) (Value, error) {
+			return IntValue(0), nil
+		},
+	})
+	v, err := prog.Run(nil)
+	assert(t, err == nil && v.Int() == 40, fmt.Sprintf("unexpected result %v %v", v, err))
+}
+
+func TestProgramConcurrentRun(t *testing.T) {
+	prog, err := Compile("var total = price * count;\ntotal >= 100 ? total - 10 : total;\n")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(count int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				expected := 25 * count
+				if expected >= 100 {
+					expected -= 10
+				}
+				local := Env{"price": 25, "count": count}
+				v, err := prog.Run(local)
+				if err != nil || v.Int() != expected {
+					t.Errorf("count %d: expected %d, but got %v %v", count, expected, v, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var wg2 sync.WaitGroup
+	shared := Env{"price": 25, "count": 4}
+	for i := 0; i < 16; i++ {
+		wg2.Add(1)
+		go func() {
+			defer wg2.Done()
+			v, err := prog.Run(shared)
+			if err != nil || v.Int() != 90 {
+				t.Errorf("expected 90, but got %v %v", v, err)
+			}
+		}()
+	}
+	wg2.Wait()
+}
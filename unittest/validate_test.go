@@ -0,0 +1,72 @@
+package unittest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+// 嵌入已有的节点类型，求值器不认识的表达式
+type customExpression struct {
+	*NumberExpression
+}
+
+func TestValidate(t *testing.T) {
+	one := &NumberExpression{Val: 1}
+	a := &IdentifierExpression{Lit: "a"}
+	invalid := []Statement{
+		nil,
+		(*ExpressionStatement)(nil),
+		&ExpressionStatement{},
+		&VarDefStatement{Expr: one},
+		&VarDefStatement{VarName: "x"},
+		&ExpressionStatement{Expr: (*NumberExpression)(nil)},
+		&ExpressionStatement{Expr: &IdentifierExpression{}},
+		&ExpressionStatement{Expr: &CallExpression{Args: []Expression{one}}},
+		&ExpressionStatement{Expr: &CallExpression{Name: "max", Args: []Expression{one, nil}}},
+		&ExpressionStatement{Expr: &BinOpExpression{LHS: one, Operator: '@', RHS: one}},
+		&ExpressionStatement{Expr: &BinOpExpression{LHS: one, Operator: '+'}},
+		&ExpressionStatement{Expr: &BinOpLogicExpression{LHS: one, Operator: '+', RHS: one}},
+		&ExpressionStatement{Expr: &UnaryMinusExpression{}},
+		&ExpressionStatement{Expr: &UnaryNotExpression{SubExpr: &ParenExpression{}}},
+		&ExpressionStatement{Expr: &TernaryExpression{Cond: a, TrueExpr: one}},
+		&ExpressionStatement{Expr: &InExpression{LHS: a, Arr: []Expression{one}, RHS: a}},
+		&ExpressionStatement{Expr: &InExpression{LHS: a, Arr: []Expression{&RangeExpression{Low: 2, High: 1}}}},
+		&ExpressionStatement{Expr: &InSetExpression{LHS: a, Arr: []Expression{a}}},
+		&ExpressionStatement{Expr: &RangeExpression{Low: 1, High: 2}},
+		&ExpressionStatement{Expr: &BinOpExpression{LHS: &RangeExpression{Low: 1, High: 2}, Operator: '+', RHS: one}},
+		&ExpressionStatement{Expr: &ArrayExpression{Arr: []Expression{one, nil}}},
+		&ExpressionStatement{Expr: customExpression{one}},
+	}
+	for i, stmt := range invalid {
+		err := Validate([]Statement{stmt})
+		var evalErr *EvalError
+		assert(t, errors.Is(err, ErrInvalidNode) && errors.As(err, &evalErr), fmt.Sprintf("%d: expect an invalid node, but got %v", i, err))
+
+		// 求值的入口都返回错误而不是panic
+		_, err = NewEvaluator().EvaluateStmtValue(stmt, Env{"a": 1})
+		assert(t, errors.Is(err, ErrInvalidNode), fmt.Sprintf("%d: expect EvaluateStmtValue to fail, but got %v", i, err))
+		_, err = Evaluate(stmt, Env{"a": 1})
+		assert(t, errors.Is(err, ErrInvalidNode), fmt.Sprintf("%d: expect Evaluate to fail, but got %v", i, err))
+		err = NewEvaluator().Check([]Statement{stmt})
+		assert(t, errors.Is(err, ErrInvalidNode), fmt.Sprintf("%d: expect Check to fail, but got %v", i, err))
+		optimized := NewEvaluator().Optimize([]Statement{stmt})
+		assert(t, len(optimized) == 1 && optimized[0] == stmt, fmt.Sprintf("%d: expect invalid statements to be kept", i))
+	}
+
+	// 未知的运算符不是可打印的ASCII字符时显示数值
+	for op, name := range map[int]string{'@': "@", 999: "999", -1: "-1", 0: "0", '\n': "10"} {
+		err := Validate([]Statement{&ExpressionStatement{Expr: &BinOpExpression{LHS: one, Operator: op, RHS: one}}})
+		assert(t, err != nil && strings.HasSuffix(err.Error(), "unknown operator "+name), fmt.Sprintf("%d: unexpected error %v", op, err))
+	}
+
+	_, err := EvaluateExpr(&BinOpExpression{LHS: one, Operator: LAND, RHS: one}, Env{})
+	assert(t, errors.Is(err, ErrInvalidNode), fmt.Sprintf("Expect logical operators in BinOpExpression to be rejected, but got %v", err))
+
+	valid, err := NewParser().ParseE("var x = [1, a, 4..5];\nx in [1, 2..3] && a not in x && a in [-1, -2.5, 3, 4] ? -~1 : max(1, 2) ** 2;\n")
+	assert(t, err == nil, fmt.Sprintf("parse failed %v", err))
+	assert(t, Validate(valid) == nil, "Expect parsed statements to be valid")
+}
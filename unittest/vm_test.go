@@ -0,0 +1,123 @@
+package unittest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+func newBackendEvaluator(backend Backend, strict bool) *Evaluator {
+	eva := NewEvaluator()
+	eva.SetBackend(backend)
+	eva.SetStrict(strict)
+	eva.SetCondHelper(&condHelper, map[int]int{1001: 6})
+	return eva
+}
+
+func TestBackendsAgree(t *testing.T) {
+	tests := []string{
+		"1 + 2 * 3 - 4 / 2 % 3",
+		"-(1.5 + 2) * 2",
+		"\"ab\" + \"cd\" == \"abcd\"",
+		"!(1 > 2) && (3 >= 3 || x)",
+		"false || 0",
+		"true && x",
+		"a > 0 ? a * 2 : -a",
+		"a < 0 ? a * 2 : (b ? 1 : 2)",
+		"a in [1, 2, 3] && 2.0 in [1, 2] && !(\"x\" in [])",
+		"a not in [1, 2..4] || a in [0..2, 5]",
+		"b not in [1, 2, 3, 4, 5..9]",
+		"charge >= 200 && age in [10, 20] && itemCount(1001) >= 5",
+		"max(a, 2, 3.5) + min(1, a) + abs(-a) + len(\"中文\")",
+		"clamp(a, 1)",
+		"foo(1)",
+		"true ? 1 : foo(1)",
+		"-\"s\"",
+		"a & 1 | 4 ^ 2 << a >> 1 + ~a",
+		"b & 1 | ~b",
+		"a << -1",
+		"a ** 3 ** 2 - -a ** 2 + pow(2.0, a) + 2 ** -1",
+		"10 ** 19",
+		"a / (a - 3)",
+		"a % 0 + 1",
+		"a / 0.0 > 1",
+		"sqrt(a * 3) + log2(1024) + sqrt(2.25) + log2(0.5)",
+		"sqrt(-a)",
+		"1.5 & 1",
+		"~\"s\"",
+		"a >> 64 == 0 && -a >> 64 == -1",
+		"1 + true",
+		"\"a\" < 1",
+		"b in [1, \"b\"]",
+		"a in [b, a - 1, a] && a not in [a + 1, [a]]",
+		"a in [1, a..5]",
+		"len([a, b, 1..3]) + len([])",
+		"a in a",
+		"a in [foo(1), a]",
+		"a in [1..10000000]",
+		"[a] == [a]",
+		"undefinedVar + 1",
+		"var c = a + 1",
+	}
+	for _, strict := range []bool{false, true} {
+		for _, src := range tests {
+			tree := newBackendEvaluator(BackendTree, strict)
+			vm := newBackendEvaluator(BackendVM, strict)
+			treeEnv, vmEnv := Env{"a": 3, "b": true}, Env{"a": 3, "b": true}
+			tv, terr := tree.EvalValue(src, treeEnv)
+			vv, verr := vm.EvalValue(src, vmEnv)
+			assert(t, tv == vv && fmt.Sprint(terr) == fmt.Sprint(verr),
+				fmt.Sprintf("%q strict=%v: tree %v %v, vm %v %v", src, strict, tv, terr, vv, verr))
+			assert(t, fmt.Sprint(treeEnv) == fmt.Sprint(vmEnv),
+				fmt.Sprintf("%q strict=%v: tree env %v, vm env %v", src, strict, treeEnv, vmEnv))
+		}
+	}
+}
+
+func TestVMProgram(t *testing.T) {
+	eva := NewEvaluator()
+	eva.SetBackend(BackendVM)
+	prog, err := eva.Compile("var total = price * count;\ntotal >= 100 ? total - 10 : total;\n")
+	assert(t, err == nil, fmt.Sprintf("compile failed %v", err))
+	for count, expected := range map[int]int{1: 25, 4: 90, 10: 240} {
+		v, err := prog.Run(Env{"price": 25, "count": count})
+		assert(t, err == nil && v.Int() == expected, fmt.Sprintf("expected %d, but got %v %v", expected, v, err))
+	}
+}
+
+// 比较两种求值方式的耗时和内存分配：Run每次绑定新的Frame，RunFrame重复使用同一个Frame
+func BenchmarkBackends(b *testing.B) {
+	src := "var total = price * count + max(bonus, 10);\ntotal >= 100 && level in [1, 5, 6] && abs(-level) < 10 ? total : 0;\n"
+	env := Env{"price": 25, "count": 4, "bonus": 3, "level": 6}
+	for _, backend := range []struct {
+		name    string
+		backend Backend
+	}{{"tree", BackendTree}, {"vm", BackendVM}} {
+		eva := NewEvaluator()
+		eva.SetBackend(backend.backend)
+		prog, err := eva.Compile(src)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(backend.name+"/Run", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := prog.Run(env); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(backend.name+"/RunFrame", func(b *testing.B) {
+			f := prog.Bind(env)
+			ctx := context.Background()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := prog.RunFrame(ctx, f); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
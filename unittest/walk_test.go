@@ -0,0 +1,137 @@
+package unittest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/motto0808/go-calc/calc"
+)
+
+func parseStatements(t *testing.T, src string) []Statement {
+	stmts, err := NewParser().ParseE(src)
+	if err != nil {
+		t.Fatalf("parse failed %v", err)
+	}
+	return stmts
+}
+
+// 记录访问的节点类型以及深度
+type depthVisitor struct {
+	depth int
+	trace *[]string
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.trace = append(*v.trace, fmt.Sprintf("%d:end", v.depth))
+		return nil
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", node), "*calc."), "Expression")
+	*v.trace = append(*v.trace, fmt.Sprintf("%d:%s", v.depth, name))
+	return depthVisitor{depth: v.depth + 1, trace: v.trace}
+}
+
+func TestWalk(t *testing.T) {
+	stmts := parseStatements(t, "var x = -a + f(1);\n")
+	var trace []string
+	Walk(depthVisitor{trace: &trace}, stmts[0])
+	// 与go/ast相同，Visit(nil)由访问子节点的Visitor调用
+	expect := "0:VarDefStatement 1:BinOp 2:UnaryMinus 3:Identifier 4:end 3:end 2:Call 3:Number 4:end 3:end 2:end 1:end"
+	assert(t, strings.Join(trace, " ") == expect, fmt.Sprintf("unexpected trace %v", trace))
+}
+
+func TestInspect(t *testing.T) {
+	stmts := parseStatements(t, "a in [b, 1..3] && c not in d ? ~e ** 2 : (!f || g(h, [i]));\n")
+	var names []string
+	Inspect(stmts[0], func(node Node) bool {
+		if id, ok := node.(*IdentifierExpression); ok {
+			names = append(names, id.Lit)
+		}
+		return true
+	})
+	assert(t, strings.Join(names, ",") == "a,b,c,d,e,f,h,i", fmt.Sprintf("unexpected identifiers %v", names))
+
+	// 返回false时跳过子节点
+	ranges, nodes := 0, 0
+	Inspect(stmts[0], func(node Node) bool {
+		if node == nil {
+			return false
+		}
+		nodes++
+		if _, ok := node.(*RangeExpression); ok {
+			ranges++
+		}
+		_, isCall := node.(*CallExpression)
+		return !isCall
+	})
+	assert(t, ranges == 1 && nodes == 19, fmt.Sprintf("unexpected counts %d %d", ranges, nodes))
+
+	// 所有节点都会被访问，哈希表中的元素也一样
+	stmts = parseStatements(t, "x in [1, 2, 3, 4, 5..6];\n")
+	_, isSet := stmts[0].(*ExpressionStatement).Expr.(*InSetExpression)
+	count := 0
+	Inspect(stmts[0], func(node Node) bool {
+		if node != nil {
+			count++
+		}
+		return true
+	})
+	assert(t, isSet && count == 8, fmt.Sprintf("unexpected count %d", count))
+}
+
+func TestTransform(t *testing.T) {
+	src := "var total = price * count;\ntotal >= limit && x in [1, 2, 3, 4];\n"
+	stmts := parseStatements(t, src)
+	// 把变量limit替换为常量，in后面的数组中的元素都加10
+	rewritten := Transform(stmts, func(expr Expression) Expression {
+		switch e := expr.(type) {
+		case *IdentifierExpression:
+			if e.Lit == "limit" {
+				return &NumberExpression{Span: e.Span, Val: 100}
+			}
+		case *NumberExpression:
+			return &NumberExpression{Span: e.Span, Val: e.Val + 10}
+		}
+		return nil
+	})
+	assert(t, len(rewritten) == 2 && Validate(rewritten) == nil, "Expect a valid rewritten tree")
+
+	eva := NewEvaluator()
+	for _, x := range []int{3, 13} {
+		env := Env{"price": 25, "count": 4, "limit": 1000, "x": x}
+		orig, err1 := eva.EvaluateStmtValue(stmts[1], Env{"total": 100, "limit": 1000, "x": x})
+		eva.EvaluateStmtValue(rewritten[0], env)
+		got, err2 := eva.EvaluateStmtValue(rewritten[1], env)
+		assert(t, err1 == nil && err2 == nil && !orig.Bool() && got.Bool() == (x == 13),
+			fmt.Sprintf("x=%d: unexpected results %v %v %v %v", x, orig, err1, got, err2))
+	}
+
+	// 原来的语法树没有被修改
+	var names []string
+	for _, stmt := range stmts {
+		Inspect(stmt, func(node Node) bool {
+			switch n := node.(type) {
+			case *IdentifierExpression:
+				names = append(names, n.Lit)
+			case *NumberExpression:
+				names = append(names, fmt.Sprint(n.Val))
+			}
+			return true
+		})
+	}
+	assert(t, strings.Join(names, ",") == "price,count,total,limit,x,1,2,3,4", fmt.Sprintf("Expect the original tree to be unchanged, got %v", names))
+
+	// 数组中出现非字面量时不再使用哈希表
+	stmts = parseStatements(t, "x in [1, 2, 3, 4];\n")
+	rewritten = Transform(stmts, func(expr Expression) Expression {
+		if n, ok := expr.(*NumberExpression); ok && n.Val == 4 {
+			return &IdentifierExpression{Span: n.Span, Lit: "y"}
+		}
+		return nil
+	})
+	_, ok := rewritten[0].(*ExpressionStatement).Expr.(*InExpression)
+	assert(t, ok, "Expect arrays with identifiers to be scanned linearly")
+	v, err := eva.EvaluateStmtValue(rewritten[0], Env{"x": 7, "y": 7})
+	assert(t, err == nil && v.Bool(), fmt.Sprintf("unexpected result %v %v", v, err))
+}